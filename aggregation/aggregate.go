@@ -0,0 +1,213 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/base-org/keyspace-recovery-service/signatures"
+	"github.com/consensys/gnark-crypto/ecc"
+	pbls12377 "github.com/consensys/gnark/backend/plonk/bls12-377"
+	pbn254 "github.com/consensys/gnark/backend/plonk/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bw6761"
+	"github.com/consensys/gnark/std/algebra/native/sw_bls12377"
+	rplonk "github.com/consensys/gnark/std/recursion/plonk"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ErrNoAccounts is returned when aggregating an empty batch.
+var ErrNoAccounts = errors.New("no account proofs to aggregate")
+
+// ErrNotDeployed is returned when the aggregation circuits have no compiled
+// version for a batch, so it cannot be aggregated by this service.
+var ErrNotDeployed = errors.New("proof aggregation is not deployed")
+
+// Account is an account proof to aggregate, as returned by
+// recover_proveSignature.
+type Account struct {
+	// Proof and Vk are serialized by signatures.ProofToBytes and
+	// signatures.VkToBytes.
+	Proof       []byte
+	Vk          []byte
+	CurrentData []byte
+	// NewKey is the NewKey public input of the proof, the Keyspace key
+	// shifted right by 2 bits.
+	NewKey *big.Int
+}
+
+type parsedAccount struct {
+	proof  *pbls12377.Proof
+	vk     *pbls12377.VerifyingKey
+	public witness.Witness
+	inputs []*big.Int
+}
+
+func (a *Account) parse() (*parsedAccount, error) {
+	proof, err := signatures.BytesToProof(a.Proof)
+	if err != nil {
+		return nil, err
+	}
+	vk, err := signatures.BytesToVk(a.Vk)
+	if err != nil {
+		return nil, err
+	}
+	public, inputs, err := signatures.AccountPublicWitness(ecc.BLS12_377.ScalarField(), a.CurrentData, a.NewKey)
+	if err != nil {
+		return nil, err
+	}
+	return &parsedAccount{proof: proof, vk: vk, public: public, inputs: inputs}, nil
+}
+
+// Commitment returns the public input of the wrapper proof for the accounts:
+// keccak256 over the vk hash, current data and 32-byte new key of each
+// account, truncated to its low 253 bits.
+func Commitment(accounts []Account) (*big.Int, error) {
+	h := crypto.NewKeccakState()
+	for _, a := range accounts {
+		if len(a.CurrentData) != signatures.RawDataSize {
+			return nil, signatures.ErrInvalidData
+		}
+		h.Write(signatures.VkHash(a.Vk).Bytes())
+		h.Write(a.CurrentData)
+		h.Write(a.NewKey.FillBytes(make([]byte, 32)))
+	}
+	digest := new(big.Int).SetBytes(h.Sum(nil))
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), commitmentBits), big.NewInt(1))
+	return digest.And(digest, mask), nil
+}
+
+// Deployed checks that the aggregation circuits have a compiled variant for
+// txCount accounts, so aggregation requests can be rejected before anything
+// is proven.
+func Deployed(txCount int) error {
+	for _, id := range []string{circuits.AccountAggregateMetadata.Id, circuits.AccountWrapperMetadata.Id} {
+		cm, err := circuits.ById(id)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotDeployed, err)
+		}
+		v, err := cm.Latest()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotDeployed, err)
+		}
+		if _, err = cm.Filename(v, txCount); err != nil {
+			return fmt.Errorf("%w: %v", ErrNotDeployed, err)
+		}
+	}
+	return nil
+}
+
+// Prove aggregates account proofs into a proof of the AccountAggregate
+// circuit, then wraps it into a BN254 proof of the AccountWrapper circuit. The
+// reporter may be nil.
+func Prove(loader proving.CircuitLoader, reporter proving.Reporter, accounts []Account) (*signatures.AggregateProofResponse, error) {
+	if len(accounts) == 0 {
+		return nil, ErrNoAccounts
+	}
+	commitment, err := Commitment(accounts)
+	if err != nil {
+		return nil, err
+	}
+	clc := proving.NewCircuitLoaderClient(loader, reporter)
+
+	aggregate := &AccountAggregate{Accounts: make([]AggregateAccount, len(accounts))}
+	for i := range accounts {
+		p, err := accounts[i].parse()
+		if err != nil {
+			return nil, fmt.Errorf("account %d: %w", i, err)
+		}
+		if err = proving.Verify(p.proof, p.vk, p.public, ecc.BLS12_377.ScalarField(), ecc.BW6_761.ScalarField()); err != nil {
+			return nil, fmt.Errorf("account %d: %w: %v", i, signatures.ErrInvalidProof, err)
+		}
+		if aggregate.Accounts[i], err = assignAccount(p); err != nil {
+			return nil, fmt.Errorf("account %d: %w", i, err)
+		}
+	}
+
+	aggCm, err := circuits.ById(circuits.AccountAggregateMetadata.Id)
+	if err != nil {
+		return nil, err
+	}
+	aggVersion, err := aggCm.Latest()
+	if err != nil {
+		return nil, err
+	}
+	aggCc, err := clc.Load(aggCm, aggVersion, len(accounts))
+	if err != nil {
+		return nil, err
+	}
+	aggProof, err := proving.ProveAssignment(*aggCm, aggCc, aggregate, reporter)
+	if err != nil {
+		return nil, err
+	}
+	if err = signatures.VerifySerialized(aggCm, aggProof, aggCc.Vk, aggregate, reporter); err != nil {
+		return nil, err
+	}
+	aggPublic, err := frontend.NewWitness(aggregate, aggCm.Field, frontend.PublicOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper := &AccountWrapper{Commitment: commitment}
+	if wrapper.Proof, err = rplonk.ValueOfProof[sw_bw6761.ScalarField, sw_bw6761.G1Affine, sw_bw6761.G2Affine](aggProof); err != nil {
+		return nil, err
+	}
+	if wrapper.Witness, err = rplonk.ValueOfWitness[sw_bw6761.ScalarField](aggPublic); err != nil {
+		return nil, err
+	}
+	wrapCm, err := circuits.ById(circuits.AccountWrapperMetadata.Id)
+	if err != nil {
+		return nil, err
+	}
+	wrapVersion, err := wrapCm.Latest()
+	if err != nil {
+		return nil, err
+	}
+	wrapCc, err := clc.Load(wrapCm, wrapVersion, len(accounts))
+	if err != nil {
+		return nil, err
+	}
+	proof, err := proving.ProveAssignment(*wrapCm, wrapCc, wrapper, reporter)
+	if err != nil {
+		return nil, err
+	}
+	if err = signatures.VerifySerialized(wrapCm, proof, wrapCc.Vk, wrapper, reporter); err != nil {
+		return nil, err
+	}
+	bn254Proof, ok := proof.(*pbn254.Proof)
+	if !ok {
+		return nil, errors.New("invalid proof")
+	}
+
+	return &signatures.AggregateProofResponse{
+		Proof:          bn254Proof.MarshalSolidity(),
+		Commitment:     (*hexutil.Big)(commitment),
+		CircuitVersion: wrapVersion.Name,
+	}, nil
+}
+
+func assignAccount(p *parsedAccount) (AggregateAccount, error) {
+	var a AggregateAccount
+	vk, _, err := signatures.VkToBigInts(p.vk)
+	if err != nil {
+		return a, err
+	}
+	for i := range a.Vk {
+		a.Vk[i] = vk[i]
+	}
+	for i := range a.Inputs {
+		a.Inputs[i] = p.inputs[i]
+	}
+	if a.Key, err = rplonk.ValueOfCircuitVerifyingKey[sw_bls12377.ScalarField, sw_bls12377.G1Affine](p.vk); err != nil {
+		return a, err
+	}
+	if a.Proof, err = rplonk.ValueOfProof[sw_bls12377.ScalarField, sw_bls12377.G1Affine, sw_bls12377.G2Affine](p.proof); err != nil {
+		return a, err
+	}
+	a.Witness, err = rplonk.ValueOfWitness[sw_bls12377.ScalarField](p.public)
+	return a, err
+}
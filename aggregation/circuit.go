@@ -0,0 +1,238 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/signatures"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bw6761"
+	"github.com/consensys/gnark/std/algebra/native/sw_bls12377"
+	"github.com/consensys/gnark/std/commitments/kzg"
+	"github.com/consensys/gnark/std/hash/sha3"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	rplonk "github.com/consensys/gnark/std/recursion/plonk"
+)
+
+const (
+	// vkElements and publicInputs are the number of aggregate public inputs
+	// exposing the verifying key and the public inputs of each account proof.
+	vkElements   = 39
+	publicInputs = signatures.DataSize/32 + 1
+	// accountElements is the number of aggregate public inputs per account.
+	accountElements = vkElements + publicInputs
+	// commitmentBits is the size of the wrapper's public input, a keccak256
+	// hash truncated to fit the BN254 scalar field.
+	commitmentBits = 253
+)
+
+func init() {
+	circuits.AccountAggregateMetadata.Definition = aggregateDefinition
+	circuits.AccountWrapperMetadata.Definition = wrapperDefinition
+}
+
+// AccountAggregate verifies a batch of BLS12-377 account proofs in BW6-761.
+// The verifying key and public inputs of each proof are public inputs of the
+// aggregate, so the wrapper can commit to them.
+type AccountAggregate struct {
+	// BaseKey is the part of the verifying key shared by all account
+	// circuits: the KZG setup and the number of public inputs.
+	BaseKey  rplonk.BaseVerifyingKey[sw_bls12377.ScalarField, sw_bls12377.G1Affine, sw_bls12377.G2Affine] `gnark:"-"`
+	Accounts []AggregateAccount
+}
+
+// AggregateAccount is one account proof verified by the aggregate circuit.
+type AggregateAccount struct {
+	// Vk and Inputs are the verifying key, as serialized by
+	// signatures.VkToBigInts, and the public inputs of the account proof.
+	Vk     [vkElements]frontend.Variable   `gnark:",public"`
+	Inputs [publicInputs]frontend.Variable `gnark:",public"`
+
+	Key     rplonk.CircuitVerifyingKey[sw_bls12377.ScalarField, sw_bls12377.G1Affine]
+	Proof   rplonk.Proof[sw_bls12377.ScalarField, sw_bls12377.G1Affine, sw_bls12377.G2Affine]
+	Witness rplonk.Witness[sw_bls12377.ScalarField]
+}
+
+// Define asserts that every account proof is valid and matches the verifying
+// key and public inputs it is exposed with.
+func (c *AccountAggregate) Define(api frontend.API) error {
+	verifier, err := rplonk.NewVerifier[sw_bls12377.ScalarField, sw_bls12377.G1Affine, sw_bls12377.G2Affine, sw_bls12377.GT](api)
+	if err != nil {
+		return err
+	}
+	field, err := emulated.NewField[sw_bls12377.ScalarField](api)
+	if err != nil {
+		return err
+	}
+	for i := range c.Accounts {
+		a := &c.Accounts[i]
+		vk := rplonk.VerifyingKey[sw_bls12377.ScalarField, sw_bls12377.G1Affine, sw_bls12377.G2Affine]{
+			BaseVerifyingKey:    c.BaseKey,
+			CircuitVerifyingKey: a.Key,
+		}
+		// Only proofs with the onchain layout can be aggregated.
+		if _, err = signatures.CircuitProofToVariables(api, field, a.Proof); err != nil {
+			return err
+		}
+		v, err := signatures.CircuitVkToVariables(api, field, vk)
+		if err != nil {
+			return err
+		}
+		for j := range a.Vk {
+			api.AssertIsEqual(a.Vk[j], v[j])
+		}
+		if len(a.Witness.Public) != len(a.Inputs) {
+			return fmt.Errorf("account proofs have %d public inputs, expected %d", len(a.Witness.Public), len(a.Inputs))
+		}
+		for j := range a.Inputs {
+			api.AssertIsEqual(a.Inputs[j], api.FromBinary(field.ToBits(&a.Witness.Public[j])...))
+		}
+		if err = verifier.AssertProof(vk, a.Proof, a.Witness); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggregateDefinition returns the aggregate circuit for txCount account
+// proofs of circuits sharing the base verifying key and the number of
+// commitments of inner.
+func aggregateDefinition(txCount int, inner plonk.VerifyingKey) (frontend.Circuit, error) {
+	if inner == nil {
+		return nil, errors.New("the aggregate circuit needs the verifying key of an account circuit")
+	}
+	vk, err := rplonk.ValueOfVerifyingKey[sw_bls12377.ScalarField, sw_bls12377.G1Affine, sw_bls12377.G2Affine](inner)
+	if err != nil {
+		return nil, err
+	}
+	commitments := len(vk.Qcp)
+	c := &AccountAggregate{
+		BaseKey:  vk.BaseVerifyingKey,
+		Accounts: make([]AggregateAccount, txCount),
+	}
+	for i := range c.Accounts {
+		c.Accounts[i] = AggregateAccount{
+			Key: rplonk.CircuitVerifyingKey[sw_bls12377.ScalarField, sw_bls12377.G1Affine]{
+				CommitmentConstraintIndexes: make([]frontend.Variable, commitments),
+				Qcp:                         make([]kzg.Commitment[sw_bls12377.G1Affine], commitments),
+			},
+			Proof: rplonk.Proof[sw_bls12377.ScalarField, sw_bls12377.G1Affine, sw_bls12377.G2Affine]{
+				BatchedProof: kzg.BatchOpeningProof[sw_bls12377.ScalarField, sw_bls12377.G1Affine]{
+					ClaimedValues: make([]emulated.Element[sw_bls12377.ScalarField], 7+commitments),
+				},
+				Bsb22Commitments: make([]kzg.Commitment[sw_bls12377.G1Affine], commitments),
+			},
+			Witness: rplonk.Witness[sw_bls12377.ScalarField]{
+				Public: make([]emulated.Element[sw_bls12377.ScalarField], vk.NbPublicVariables),
+			},
+		}
+	}
+	return c, nil
+}
+
+// AccountWrapper verifies an aggregate proof in BN254, so it can be verified
+// on Ethereum. Its only public input is the Commitment to the aggregated
+// accounts computed by Commitment.
+type AccountWrapper struct {
+	// Vk is the verifying key of the aggregate circuit with the same number
+	// of accounts.
+	Vk         rplonk.VerifyingKey[sw_bw6761.ScalarField, sw_bw6761.G1Affine, sw_bw6761.G2Affine] `gnark:"-"`
+	Proof      rplonk.Proof[sw_bw6761.ScalarField, sw_bw6761.G1Affine, sw_bw6761.G2Affine]
+	Witness    rplonk.Witness[sw_bw6761.ScalarField]
+	Commitment frontend.Variable `gnark:",public"`
+}
+
+// Define asserts that the aggregate proof is valid and that Commitment is the
+// commitment to the accounts it exposes.
+func (c *AccountWrapper) Define(api frontend.API) error {
+	if len(c.Witness.Public)%accountElements != 0 {
+		return fmt.Errorf("aggregate proofs have %d public inputs, expected a multiple of %d", len(c.Witness.Public), accountElements)
+	}
+	verifier, err := rplonk.NewVerifier[sw_bw6761.ScalarField, sw_bw6761.G1Affine, sw_bw6761.G2Affine, sw_bw6761.GTEl](api)
+	if err != nil {
+		return err
+	}
+	if err = verifier.AssertProof(c.Vk, c.Proof, c.Witness); err != nil {
+		return err
+	}
+
+	field, err := emulated.NewField[sw_bw6761.ScalarField](api)
+	if err != nil {
+		return err
+	}
+	binaryField, err := uints.New[uints.U64](api)
+	if err != nil {
+		return err
+	}
+	commitment, err := sha3.NewLegacyKeccak256(api)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(c.Witness.Public); i += accountElements {
+		var vk [vkElements]emulated.Element[sw_bw6761.ScalarField]
+		copy(vk[:], c.Witness.Public[i:i+vkElements])
+		var data [signatures.DataSize / 32]emulated.Element[sw_bw6761.ScalarField]
+		copy(data[:], c.Witness.Public[i+vkElements:i+accountElements-1])
+		newKey := &c.Witness.Public[i+accountElements-1]
+
+		vkHash, err := sha3.NewLegacyKeccak256(api)
+		if err != nil {
+			return err
+		}
+		vkHash.Write(signatures.EmulatedVkToUints8(api, field, binaryField, vk))
+		commitment.Write(vkHash.Sum())
+		commitment.Write(signatures.DataToUints8(api, field, binaryField, data))
+		commitment.Write(elementToUints8(api, field, binaryField, newKey))
+	}
+
+	// The digest is big-endian; keep its low commitmentBits bits.
+	digest := commitment.Sum()
+	var bits []frontend.Variable
+	for i := len(digest) - 1; i >= 0; i-- {
+		bits = append(bits, api.ToBinary(digest[i].Val, 8)...)
+	}
+	api.AssertIsEqual(c.Commitment, api.FromBinary(bits[:commitmentBits]...))
+	return nil
+}
+
+// wrapperDefinition returns the wrapper circuit verifying proofs of the
+// aggregate circuit with verifying key inner.
+func wrapperDefinition(txCount int, inner plonk.VerifyingKey) (frontend.Circuit, error) {
+	if inner == nil {
+		return nil, errors.New("the wrapper circuit needs the verifying key of the aggregate circuit")
+	}
+	vk, err := rplonk.ValueOfVerifyingKey[sw_bw6761.ScalarField, sw_bw6761.G1Affine, sw_bw6761.G2Affine](inner)
+	if err != nil {
+		return nil, err
+	}
+	if n := int(vk.NbPublicVariables); n != txCount*accountElements {
+		return nil, fmt.Errorf("aggregate verifying key has %d public inputs, expected %d for %d accounts", n, txCount*accountElements, txCount)
+	}
+	commitments := len(vk.CommitmentConstraintIndexes)
+	return &AccountWrapper{
+		Vk: vk,
+		Proof: rplonk.Proof[sw_bw6761.ScalarField, sw_bw6761.G1Affine, sw_bw6761.G2Affine]{
+			BatchedProof: kzg.BatchOpeningProof[sw_bw6761.ScalarField, sw_bw6761.G1Affine]{
+				ClaimedValues: make([]emulated.Element[sw_bw6761.ScalarField], 7+commitments),
+			},
+			Bsb22Commitments: make([]kzg.Commitment[sw_bw6761.G1Affine], commitments),
+		},
+		Witness: rplonk.Witness[sw_bw6761.ScalarField]{
+			Public: make([]emulated.Element[sw_bw6761.ScalarField], vk.NbPublicVariables),
+		},
+	}, nil
+}
+
+// elementToUints8 serializes an emulated scalar as 32 big-endian bytes.
+func elementToUints8(api frontend.API, field *emulated.Field[sw_bw6761.ScalarField], binaryField *uints.BinaryField[uints.U64], e *emulated.Element[sw_bw6761.ScalarField]) []uints.U8 {
+	bits := field.ToBits(e)
+	b := make([]uints.U8, 32)
+	for i := range b {
+		j := len(b) - i - 1
+		b[i] = binaryField.ByteValueOf(api.FromBinary(bits[j*8 : j*8+8]...))
+	}
+	return b
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrUnauthorized is returned when a request carries missing or invalid credentials.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Identity describes the caller of an RPC method. Subject is empty for
+// anonymous callers.
+type Identity struct {
+	Subject string
+	IP      string
+}
+
+type Config struct {
+	// APIKeys are accepted as `Authorization: Bearer <key>` or `X-API-Key: <key>`.
+	// Entries may be given as `name:key` to log a name instead of a key digest.
+	APIKeys []string
+	// JWTSecret enables HS256 JWT bearer tokens; the `sub` claim becomes the subject.
+	JWTSecret string
+	// ClientCertAuth accepts verified TLS client certificates, using the
+	// certificate's common name as the subject.
+	ClientCertAuth bool
+	// RealIPHeader, if set, is trusted to carry the client IP (e.g. X-Forwarded-For)
+	// when the service runs behind a proxy. Only set it behind proxies that
+	// append to or overwrite the header, as clients can send it themselves.
+	RealIPHeader string
+	// RealIPHops is the number of trusted proxies appending to RealIPHeader,
+	// so the client IP is the entry that many from the right. Entries further
+	// left are set by the client and ignored. Zero means one.
+	RealIPHops int
+}
+
+type Authenticator struct {
+	apiKeys        map[string]string
+	jwtSecret      []byte
+	clientCertAuth bool
+	realIPHeader   string
+	realIPHops     int
+
+	lock  sync.Mutex
+	conns map[string]Identity
+}
+
+func NewAuthenticator(cfg Config) *Authenticator {
+	a := &Authenticator{
+		apiKeys:        make(map[string]string),
+		clientCertAuth: cfg.ClientCertAuth,
+		realIPHeader:   cfg.RealIPHeader,
+		realIPHops:     max(cfg.RealIPHops, 1),
+		conns:          make(map[string]Identity),
+	}
+	for _, k := range cfg.APIKeys {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(k, ":")
+		if !ok {
+			key = name
+			digest := sha256.Sum256([]byte(key))
+			name = "key-" + hex.EncodeToString(digest[:4])
+		}
+		a.apiKeys[key] = name
+	}
+	if cfg.JWTSecret != "" {
+		a.jwtSecret = []byte(cfg.JWTSecret)
+	}
+	return a
+}
+
+// Enabled reports whether credentials are required.
+func (a *Authenticator) Enabled() bool {
+	return len(a.apiKeys) > 0 || a.jwtSecret != nil || a.clientCertAuth
+}
+
+// Authenticate resolves the identity of an HTTP request, returning
+// ErrUnauthorized if authentication is enabled and no valid credentials are
+// present.
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	id := Identity{IP: a.clientIP(r)}
+	if !a.Enabled() {
+		return id, nil
+	}
+	if subject, ok := a.clientCert(r); ok {
+		id.Subject = subject
+		return id, nil
+	}
+	token := r.Header.Get("X-API-Key")
+	if token == "" {
+		token, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		return id, ErrUnauthorized
+	}
+	if name, ok := a.apiKey(token); ok {
+		id.Subject = name
+		return id, nil
+	}
+	if a.jwtSecret != nil {
+		subject, err := a.parseJWT(token)
+		if err != nil {
+			return id, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+		}
+		id.Subject = subject
+		return id, nil
+	}
+	return id, ErrUnauthorized
+}
+
+func (a *Authenticator) apiKey(token string) (string, bool) {
+	for key, name := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// clientCert returns the subject of a verified TLS client certificate.
+func (a *Authenticator) clientCert(r *http.Request) (string, bool) {
+	if !a.clientCertAuth || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	if leaf.Subject.CommonName != "" {
+		return "cert:" + leaf.Subject.CommonName, true
+	}
+	if len(leaf.DNSNames) > 0 {
+		return "cert:" + leaf.DNSNames[0], true
+	}
+	return "cert:" + leaf.SerialNumber.String(), true
+}
+
+func (a *Authenticator) parseJWT(token string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return a.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject == "" {
+		return "", errors.New("missing sub claim")
+	}
+	return claims.Subject, nil
+}
+
+// clientIP returns the IP of the client, taken from the real IP header
+// realIPHops entries from the right: the entries on its left are sent by the
+// client, so they could be changed on every request to evade the per-IP
+// limits. Requests with fewer entries than trusted hops did not come through
+// every proxy and fall back to the address of the connection.
+func (a *Authenticator) clientIP(r *http.Request) string {
+	if a.realIPHeader != "" {
+		var entries []string
+		for _, v := range r.Header.Values(a.realIPHeader) {
+			for _, e := range strings.Split(v, ",") {
+				if e = strings.TrimSpace(e); e != "" {
+					entries = append(entries, e)
+				}
+			}
+		}
+		if len(entries) >= a.realIPHops {
+			return entries[len(entries)-a.realIPHops]
+		}
+	}
+	return hostOnly(r.RemoteAddr)
+}
+
+type identityContextKey struct{}
+
+// Identity returns the identity of the caller of an RPC method. HTTP calls
+// carry it in the request context; WebSocket calls are resolved through the
+// connection they arrived on.
+func (a *Authenticator) Identity(ctx context.Context) Identity {
+	if id, ok := ctx.Value(identityContextKey{}).(Identity); ok {
+		return id
+	}
+	peer := rpc.PeerInfoFromContext(ctx)
+	a.lock.Lock()
+	id, ok := a.conns[peer.RemoteAddr]
+	a.lock.Unlock()
+	if ok {
+		return id
+	}
+	return Identity{IP: hostOnly(peer.RemoteAddr)}
+}
+
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
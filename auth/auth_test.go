@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPIgnoresSpoofedForwardedFor(t *testing.T) {
+	a := NewAuthenticator(Config{RealIPHeader: "X-Forwarded-For"})
+	ip := func(xff ...string) string {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		for _, v := range xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		return a.clientIP(r)
+	}
+
+	if got := ip("203.0.113.7"); got != "203.0.113.7" {
+		t.Fatalf("got %s", got)
+	}
+	for _, spoofed := range [][]string{
+		{"198.51.100.1, 203.0.113.7"},
+		{"198.51.100.2,198.51.100.3, 203.0.113.7"},
+		{"198.51.100.4", "203.0.113.7"},
+	} {
+		if got := ip(spoofed...); got != "203.0.113.7" {
+			t.Errorf("%q: got %s, expected the proxy's entry", spoofed, got)
+		}
+	}
+	if got := ip(); got != "10.0.0.1" {
+		t.Errorf("without the header: got %s", got)
+	}
+}
+
+func TestClientIPTrustedHops(t *testing.T) {
+	a := NewAuthenticator(Config{RealIPHeader: "X-Forwarded-For", RealIPHops: 2})
+	r := httptest.NewRequest("POST", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.0.0.2")
+	if got := a.clientIP(r); got != "203.0.113.7" {
+		t.Fatalf("got %s", got)
+	}
+	// Too few entries means the request bypassed a proxy.
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := a.clientIP(r); got != "10.0.0.1" {
+		t.Fatalf("got %s", got)
+	}
+}
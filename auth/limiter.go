@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// LimitError is returned when a caller exceeds a rate limit or job quota. It
+// maps to the JSON-RPC "limit exceeded" error code.
+type LimitError struct {
+	msg string
+}
+
+func (e *LimitError) Error() string  { return e.msg }
+func (e *LimitError) ErrorCode() int { return -32005 }
+
+type Limit struct {
+	// PerMinute is the sustained number of proofs allowed per minute; 0 disables
+	// rate limiting.
+	PerMinute float64
+	// Burst is the number of proofs that may be requested at once, which
+	// bounds the size of a batch when rate limiting is enabled.
+	Burst int
+	// MaxConcurrent is the number of queued or running jobs allowed at once; 0
+	// disables the quota.
+	MaxConcurrent int
+}
+
+// checkBatch returns an error if a batch of n proofs can never be acquired
+// under the limit.
+func (l Limit) checkBatch(n int) error {
+	if l.PerMinute > 0 && n > max(l.Burst, 1) {
+		return fmt.Errorf("exceeds the burst (max %d)", max(l.Burst, 1))
+	}
+	if l.MaxConcurrent > 0 && n > l.MaxConcurrent {
+		return fmt.Errorf("exceeds the concurrent job quota (max %d)", l.MaxConcurrent)
+	}
+	return nil
+}
+
+type LimiterConfig struct {
+	// Key applies to authenticated callers, keyed by subject.
+	Key Limit
+	// IP applies to every caller, keyed by client IP.
+	IP Limit
+}
+
+// CheckBatch returns an error if batches of n proofs, the largest a caller
+// may request, would always be rejected by the limits.
+func (c LimiterConfig) CheckBatch(n int) error {
+	if err := c.Key.checkBatch(n); err != nil {
+		return fmt.Errorf("a batch of %d proofs %v per key", n, err)
+	}
+	if err := c.IP.checkBatch(n); err != nil {
+		return fmt.Errorf("a batch of %d proofs %v per IP", n, err)
+	}
+	return nil
+}
+
+// Limiter enforces per-key and per-IP token-bucket rate limits and concurrent
+// job quotas.
+type Limiter struct {
+	cfg    LimiterConfig
+	lock   sync.Mutex
+	keys   map[string]*usage
+	ips    map[string]*usage
+	now    func() time.Time
+	pruned time.Time
+}
+
+type usage struct {
+	tokens  float64
+	updated time.Time
+	active  int
+}
+
+func NewLimiter(cfg LimiterConfig) *Limiter {
+	return &Limiter{
+		cfg:  cfg,
+		keys: make(map[string]*usage),
+		ips:  make(map[string]*usage),
+		now:  time.Now,
+	}
+}
+
+// Acquire charges one proof to the caller, returning a release function that
+// must be called once the job has finished.
+func (l *Limiter) Acquire(id Identity) (func(), error) {
+	return l.AcquireN(id, 1)
+}
+
+// AcquireN charges n proofs to the caller at once for a batch of n jobs,
+// taking n tokens and n concurrent job slots until it is released. Batches
+// larger than the burst or the concurrent job quota are rejected.
+func (l *Limiter) AcquireN(id Identity, n int) (func(), error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	l.prune(now)
+
+	type check struct {
+		name  string
+		limit Limit
+		u     *usage
+	}
+	checks := []check{{"ip " + id.IP, l.cfg.IP, l.usage(l.ips, id.IP, l.cfg.IP, now)}}
+	if id.Subject != "" {
+		checks = append(checks, check{"key " + id.Subject, l.cfg.Key, l.usage(l.keys, id.Subject, l.cfg.Key, now)})
+	}
+	for _, c := range checks {
+		if err := c.limit.checkBatch(n); err != nil {
+			return nil, &LimitError{fmt.Sprintf("batch of %d proofs %v for %s", n, err, c.name)}
+		}
+		if c.limit.MaxConcurrent > 0 && c.u.active+n > c.limit.MaxConcurrent {
+			return nil, &LimitError{fmt.Sprintf("too many concurrent jobs for %s (max %d)", c.name, c.limit.MaxConcurrent)}
+		}
+		if c.limit.PerMinute > 0 && c.u.tokens < float64(n) {
+			return nil, &LimitError{fmt.Sprintf("rate limit exceeded for %s", c.name)}
+		}
+	}
+	for _, c := range checks {
+		c.u.active += n
+		if c.limit.PerMinute > 0 {
+			c.u.tokens -= float64(n)
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+			for _, c := range checks {
+				c.u.active -= n
+			}
+		})
+	}, nil
+}
+
+// usage returns the refilled bucket for key. Must be called with l.lock held.
+func (l *Limiter) usage(m map[string]*usage, key string, limit Limit, now time.Time) *usage {
+	u, ok := m[key]
+	if !ok {
+		u = &usage{tokens: float64(max(limit.Burst, 1)), updated: now}
+		m[key] = u
+	}
+	elapsed := now.Sub(u.updated).Minutes()
+	u.tokens = math.Min(float64(max(limit.Burst, 1)), u.tokens+elapsed*limit.PerMinute)
+	u.updated = now
+	return u
+}
+
+// prune drops idle entries with full buckets so the maps don't grow without
+// bound. Must be called with l.lock held.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	l.pruned = now
+	for _, m := range []map[string]*usage{l.keys, l.ips} {
+		for k, u := range m {
+			if u.active == 0 && now.Sub(u.updated) > time.Hour {
+				delete(m, k)
+			}
+		}
+	}
+}
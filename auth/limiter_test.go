@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcquireNTakesOneSlotPerJob(t *testing.T) {
+	l := NewLimiter(LimiterConfig{IP: Limit{MaxConcurrent: 4}})
+	id := Identity{IP: "192.0.2.1"}
+	release, err := l.AcquireN(id, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.AcquireN(id, 2); err == nil {
+		t.Fatal("acquired 5 jobs with a quota of 4")
+	}
+	releaseOne, err := l.Acquire(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseOne()
+	release()
+	release()
+	if _, err = l.AcquireN(id, 4); err != nil {
+		t.Fatalf("slots not released: %v", err)
+	}
+	if _, err = l.AcquireN(Identity{IP: "192.0.2.2"}, 5); err == nil {
+		t.Fatal("acquired a batch larger than the quota")
+	}
+}
+
+func TestAcquireNChargesOneTokenPerProof(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(LimiterConfig{Key: Limit{PerMinute: 2, Burst: 4}})
+	l.now = func() time.Time { return now }
+	id := Identity{Subject: "ops", IP: "192.0.2.1"}
+	if _, err := l.AcquireN(id, 5); err == nil {
+		t.Fatal("acquired a batch larger than the burst")
+	}
+	if _, err := l.AcquireN(id, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.AcquireN(id, 2); err == nil {
+		t.Fatal("acquired more tokens than left in the bucket")
+	}
+	now = now.Add(30 * time.Second)
+	if _, err := l.AcquireN(id, 2); err != nil {
+		t.Fatalf("bucket not refilled: %v", err)
+	}
+}
+
+func TestLimiterConfigCheckBatch(t *testing.T) {
+	for _, tt := range []struct {
+		cfg LimiterConfig
+		ok  bool
+	}{
+		{LimiterConfig{}, true},
+		{LimiterConfig{Key: Limit{Burst: 1}}, true},
+		{LimiterConfig{Key: Limit{PerMinute: 10, Burst: 1}}, false},
+		{LimiterConfig{IP: Limit{PerMinute: 10, Burst: 8}}, true},
+		{LimiterConfig{IP: Limit{MaxConcurrent: 4}}, false},
+		{LimiterConfig{Key: Limit{MaxConcurrent: 8}}, true},
+	} {
+		if err := tt.cfg.CheckBatch(8); (err == nil) != tt.ok {
+			t.Errorf("%+v: got %v", tt.cfg, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Middleware authenticates requests before passing them to next, attaching the
+// caller's identity to the request context. WebSocket connections are tracked
+// for their lifetime so calls made over them resolve to the same identity.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if err != nil {
+			log.Debug("Rejected unauthenticated request", "ip", id.IP, "error", err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), identityContextKey{}, id))
+		if _, ok := w.(http.Hijacker); ok {
+			w = &trackingWriter{ResponseWriter: w, auth: a, id: id}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type trackingWriter struct {
+	http.ResponseWriter
+	auth *Authenticator
+	id   Identity
+}
+
+func (t *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := t.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	addr := conn.RemoteAddr().String()
+	t.auth.lock.Lock()
+	t.auth.conns[addr] = t.id
+	t.auth.lock.Unlock()
+	return &trackedConn{Conn: conn, release: func() {
+		t.auth.lock.Lock()
+		delete(t.auth.conns, addr)
+		t.auth.lock.Unlock()
+	}}, rw, nil
+}
+
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
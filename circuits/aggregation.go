@@ -0,0 +1,27 @@
+package circuits
+
+import "github.com/consensys/gnark-crypto/ecc"
+
+// AccountAggregateMetadata is the BW6-761 circuit that verifies a batch of
+// account proofs, one variant per batch size. Its definition is registered by
+// the aggregation package, as it builds on the account proof serialization.
+var AccountAggregateMetadata = &Metadata{
+	Id:          "AccountAggregate",
+	Field:       ecc.BW6_761.ScalarField(),
+	Outer:       ecc.BN254.ScalarField(),
+	Commitments: 1,
+	MultiTx:     true,
+	Inner:       Secp256k1AccountMetadata.Id,
+}
+
+// AccountWrapperMetadata is the BN254 circuit that verifies an aggregate
+// proof, producing a proof that can be verified on Ethereum.
+var AccountWrapperMetadata = &Metadata{
+	Id:          "AccountWrapper",
+	Field:       ecc.BN254.ScalarField(),
+	Outer:       ecc.BN254.ScalarField(),
+	Commitments: 1,
+	MultiTx:     true,
+	Solidity:    true,
+	Inner:       "AccountAggregate",
+}
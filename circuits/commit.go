@@ -0,0 +1,42 @@
+package circuits
+
+import (
+	"errors"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+// commitSeparately adds a BSB22 commitment to each group of variables. The
+// gnark gadgets share a single commitment, while the deployed verifying keys
+// have accountCommitments of them, so the BLS12-377 account circuits commit
+// to their witness groups on their own to produce keys in that layout.
+//
+// The commitments only bind the prover to the committed values and do not
+// change which witnesses satisfy the circuit. The groups committed by the
+// deployed circuits are not recorded in this repository, so the ones chosen
+// here produce the deployed count but not necessarily the deployed
+// constraint system: `circuits fingerprint --source --srs` compares the
+// compiled definitions with the stored artifacts, and until it matches they
+// must be released as a new version rather than replace the deployed ones.
+func commitSeparately(api frontend.API, groups ...[]frontend.Variable) error {
+	committer, ok := api.Compiler().(frontend.Committer)
+	if !ok {
+		return errors.New("builder does not support commitments")
+	}
+	for _, vars := range groups {
+		if _, err := committer.Commit(vars...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// u8Vals returns the variables holding bytes.
+func u8Vals(bytes []uints.U8) []frontend.Variable {
+	vals := make([]frontend.Variable, len(bytes))
+	for i := range bytes {
+		vals[i] = bytes[i].Val
+	}
+	return vals
+}
@@ -1,30 +1,72 @@
 package circuits
 
 import (
-	"errors"
+	"fmt"
+	"slices"
 
 	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
 	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_emulated"
+	"github.com/consensys/gnark/std/hash/sha2"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
 	gecdsa "github.com/consensys/gnark/std/signature/ecdsa"
 )
 
+const (
+	// newKeyBits is the size of the NewKey public input, a BN254 Keyspace key
+	// shifted right by 2 bits.
+	newKeyBits = 252
+	// accountCommitments is the number of BSB22 commitments of the deployed
+	// BLS12-377 account circuits. Their verifying keys, whose keccak256 hashes
+	// are the filenames in filenames.go and the keys registered onchain, have
+	// three commitment constraint indexes and Qcp points in the 1664-byte
+	// layout of signatures.VkToBytes, and their proofs three BSB22 commitments
+	// in the 1504-byte layout of signatures.ProofToBytes. The aggregation
+	// circuit verifies the same layout. A circuit with another count could be
+	// proven but neither serialized nor aggregated.
+	accountCommitments = 3
+)
+
 type EcdsaAccount[T, S emulated.FieldParams] struct {
 	CurrentData [9]frontend.Variable `gnark:",public"`
 	NewKey      frontend.Variable    `gnark:",public"`
 	Sig         gecdsa.Signature[S]
+
+	// separateCommitments makes the circuit commit to the signature
+	// components separately, see commitSeparately.
+	separateCommitments bool
 }
 
+// Define asserts that Sig is a valid signature of NewKey by the public key
+// stored in CurrentData.
 func (c *EcdsaAccount[T, S]) Define(api frontend.API) error {
-	return errors.New("not implemented")
+	if c.separateCommitments {
+		if err := commitSeparately(api, c.Sig.R.Limbs, c.Sig.S.Limbs); err != nil {
+			return err
+		}
+	}
+	x, y, err := dataPublicKey[T](api, c.CurrentData)
+	if err != nil {
+		return err
+	}
+	scalarField, err := emulated.NewField[S](api)
+	if err != nil {
+		return err
+	}
+	msg := scalarField.FromBits(api.ToBinary(c.NewKey, newKeyBits)...)
+	return verifyEcdsa[T, S](api, x, y, msg, &c.Sig)
 }
 
 var Secp256k1AccountMetadata = &Metadata{
 	Id:          "Secp256k1Account",
 	Field:       ecc.BLS12_377.ScalarField(),
 	Outer:       ecc.BW6_761.ScalarField(),
-	Commitments: 3,
+	Commitments: accountCommitments,
+	Definition: func(int, plonk.VerifyingKey) (frontend.Circuit, error) {
+		return &EcdsaAccount[emulated.Secp256k1Fp, emulated.Secp256k1Fr]{separateCommitments: true}, nil
+	},
 }
 
 type WebauthnAccount struct {
@@ -35,15 +77,97 @@ type WebauthnAccount struct {
 	ClientDataSuffixBlockCount frontend.Variable
 	PaddedClientDataSuffix     [241]uints.U8
 	AuthenticatorData          [37]uints.U8
+
+	// separateCommitments makes the circuit commit to the signature and the
+	// signed data separately, see commitSeparately.
+	separateCommitments bool
 }
 
+// Define asserts that Sig is a valid P-256 WebAuthn assertion signature, by
+// the public key stored in CurrentData, over a clientDataJSON whose challenge
+// is NewKey.
 func (c *WebauthnAccount) Define(api frontend.API) error {
-	return errors.New("not implemented")
+	if c.separateCommitments {
+		sig := append(slices.Clone(c.Sig.R.Limbs), c.Sig.S.Limbs...)
+		signed := append(u8Vals(c.PaddedClientDataSuffix[:]), u8Vals(c.AuthenticatorData[:])...)
+		if err := commitSeparately(api, sig, signed); err != nil {
+			return err
+		}
+	}
+	x, y, err := dataPublicKey[emulated.P256Fp](api, c.CurrentData)
+	if err != nil {
+		return err
+	}
+	uapi, err := uints.New[uints.U32](api)
+	if err != nil {
+		return err
+	}
+
+	challenge := base64URLChallenge(api, uapi, c.NewKey)
+	clientHash := clientDataHash(api, uapi, challenge, c.PaddedClientDataSuffix[:], c.ClientDataSuffixBlockCount)
+
+	h, err := sha2.New(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.AuthenticatorData[:])
+	h.Write(clientHash)
+	hash := h.Sum()
+
+	scalarField, err := emulated.NewField[emulated.P256Fr](api)
+	if err != nil {
+		return err
+	}
+	msg := scalarField.FromBits(u8sToBits(api, hash)...)
+	return verifyEcdsa[emulated.P256Fp, emulated.P256Fr](api, x, y, msg, &c.Sig)
 }
 
 var WebauthnAccountMetadata = &Metadata{
 	Id:          "WebauthnAccount",
 	Field:       ecc.BLS12_377.ScalarField(),
 	Outer:       ecc.BW6_761.ScalarField(),
-	Commitments: 3,
+	Commitments: accountCommitments,
+	Definition: func(int, plonk.VerifyingKey) (frontend.Circuit, error) {
+		return &WebauthnAccount{separateCommitments: true}, nil
+	},
+}
+
+// Secp256k1AccountBn254Metadata and WebauthnAccountBn254Metadata are the
+// account circuits compiled on BN254, whose proofs are verified on Ethereum
+// directly rather than through aggregation. Their layout isn't fixed by an
+// onchain verifier yet, so they keep the single commitment gnark's gadgets
+// share.
+var (
+	Secp256k1AccountBn254Metadata = &Metadata{
+		Id:          "Secp256k1AccountBn254",
+		Field:       ecc.BN254.ScalarField(),
+		Outer:       ecc.BN254.ScalarField(),
+		Commitments: 1,
+		Solidity:    true,
+		Definition: func(int, plonk.VerifyingKey) (frontend.Circuit, error) {
+			return &EcdsaAccount[emulated.Secp256k1Fp, emulated.Secp256k1Fr]{}, nil
+		},
+	}
+	WebauthnAccountBn254Metadata = &Metadata{
+		Id:          "WebauthnAccountBn254",
+		Field:       ecc.BN254.ScalarField(),
+		Outer:       ecc.BN254.ScalarField(),
+		Commitments: 1,
+		Solidity:    true,
+		Definition: func(int, plonk.VerifyingKey) (frontend.Circuit, error) {
+			return &WebauthnAccount{}, nil
+		},
+	}
+)
+
+func verifyEcdsa[T, S emulated.FieldParams](api frontend.API, x, y *emulated.Element[T], msg *emulated.Element[S], sig *gecdsa.Signature[S]) error {
+	params := sw_emulated.GetCurveParams[T]()
+	curve, err := sw_emulated.New[T, S](api, params)
+	if err != nil {
+		return fmt.Errorf("unable to create curve: %w", err)
+	}
+	pk := gecdsa.PublicKey[T, S]{X: *x, Y: *y}
+	curve.AssertIsOnCurve((*sw_emulated.AffinePoint[T])(&pk))
+	pk.Verify(api, params, msg, sig)
+	return nil
 }
@@ -0,0 +1,26 @@
+package circuits
+
+import (
+	"testing"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+)
+
+// TestAccountCommitments checks that the account circuits compile to the
+// number of commitments their proofs are serialized with.
+func TestAccountCommitments(t *testing.T) {
+	for _, cm := range []*Metadata{Secp256k1AccountMetadata, WebauthnAccountMetadata, Secp256k1AccountBn254Metadata, WebauthnAccountBn254Metadata} {
+		circuit, err := cm.Definition(1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ccs, err := frontend.Compile(cm.Field, scs.NewBuilder, circuit)
+		if err != nil {
+			t.Fatalf("%s: %v", cm.Id, err)
+		}
+		if n := len(ccs.GetCommitments().CommitmentIndexes()); n != cm.Commitments {
+			t.Errorf("%s: got %d commitments, expected %d", cm.Id, n, cm.Commitments)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package circuits
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+)
+
+const (
+	// dataSize is the number of bytes encoded by the CurrentData public inputs.
+	dataSize = 256
+	// dataChunkSize is the number of bytes packed into each CurrentData element.
+	dataChunkSize = 31
+	// publicKeySize is the number of leading data bytes holding the public key
+	// coordinates; the remaining bytes must be zero.
+	publicKeySize = 64
+)
+
+// ClientDataJSONPrefix is the fixed start of the WebAuthn clientDataJSON, up to
+// the challenge.
+const ClientDataJSONPrefix = `{"type":"webauthn.get","challenge":"`
+
+// dataBits decomposes the CurrentData public inputs into the bytes they
+// encode, in the big-endian 31-byte chunking of signatures.DataToBytes31Chunks.
+// Each byte is returned as its little-endian bits.
+func dataBits(api frontend.API, data [9]frontend.Variable) [][]frontend.Variable {
+	bytes := make([][]frontend.Variable, 0, dataSize)
+	for i := range data {
+		n := dataChunkSize
+		if i == len(data)-1 {
+			n = dataSize - (len(data)-1)*dataChunkSize
+		}
+		bits := api.ToBinary(data[i], n*8)
+		for k := 0; k < n; k++ {
+			bytes = append(bytes, bits[(n-1-k)*8:(n-k)*8])
+		}
+	}
+	return bytes
+}
+
+// bigEndianToBits converts big-endian bytes given as little-endian bits into
+// a single little-endian bit slice.
+func bigEndianToBits(bytes [][]frontend.Variable) []frontend.Variable {
+	bits := make([]frontend.Variable, 0, len(bytes)*8)
+	for i := len(bytes) - 1; i >= 0; i-- {
+		bits = append(bits, bytes[i]...)
+	}
+	return bits
+}
+
+// dataPublicKey reads the affine coordinates of a public key from the
+// CurrentData public inputs, asserting that the data holds nothing else.
+func dataPublicKey[T emulated.FieldParams](api frontend.API, data [9]frontend.Variable) (x, y *emulated.Element[T], err error) {
+	field, err := emulated.NewField[T](api)
+	if err != nil {
+		return nil, nil, err
+	}
+	bytes := dataBits(api, data)
+	for _, b := range bytes[publicKeySize:] {
+		for _, bit := range b {
+			api.AssertIsEqual(bit, 0)
+		}
+	}
+	x = field.FromBits(bigEndianToBits(bytes[:publicKeySize/2])...)
+	y = field.FromBits(bigEndianToBits(bytes[publicKeySize/2 : publicKeySize])...)
+	return x, y, nil
+}
+
+// u8sToBits converts big-endian bytes into a little-endian bit slice.
+func u8sToBits(api frontend.API, bytes []uints.U8) []frontend.Variable {
+	b := make([][]frontend.Variable, len(bytes))
+	for i := range bytes {
+		b[i] = api.ToBinary(bytes[i].Val, 8)
+	}
+	return bigEndianToBits(b)
+}
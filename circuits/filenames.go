@@ -1,10 +1,22 @@
+// Code generated by keyspace-recovery-service circuits build. DO NOT EDIT.
+
 package circuits
 
 func init() {
-	Secp256k1AccountMetadata.Filenames = []string{
-		"51baa0cc62607033629f491a79cca59244f2d3b4d122d5dabb4f5c3d18a35155",
+	Secp256k1AccountMetadata.Versions = []*Version{
+		{
+			Name: "v1",
+			Filenames: []string{
+				"51baa0cc62607033629f491a79cca59244f2d3b4d122d5dabb4f5c3d18a35155",
+			},
+		},
 	}
-	WebauthnAccountMetadata.Filenames = []string{
-		"c2583fec42f1a77ba7df0a637b23352cf489eb8daca31d1569df0ae3302260de",
+	WebauthnAccountMetadata.Versions = []*Version{
+		{
+			Name: "v1",
+			Filenames: []string{
+				"c2583fec42f1a77ba7df0a637b23352cf489eb8daca31d1569df0ae3302260de",
+			},
+		},
 	}
 }
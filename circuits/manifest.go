@@ -0,0 +1,257 @@
+package circuits
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/consensys/gnark-crypto/ecc"
+)
+
+// Manifest describes the circuits known to the service and their compiled
+// versions, so they can be added or rotated without rebuilding the binary.
+type Manifest struct {
+	Circuits []ManifestCircuit `json:"circuits" toml:"circuits"`
+}
+
+type ManifestCircuit struct {
+	Id string `json:"id" toml:"id"`
+	// Curve and Outer name the curves whose scalar fields are the circuit's
+	// field and outer field, e.g. "bls12_377" and "bw6_761".
+	Curve       string            `json:"curve" toml:"curve"`
+	Outer       string            `json:"outer" toml:"outer"`
+	Commitments int               `json:"commitments" toml:"commitments"`
+	MultiTx     bool              `json:"multiTx" toml:"multiTx"`
+	Solidity    bool              `json:"solidity" toml:"solidity"`
+	Versions    []ManifestVersion `json:"versions" toml:"versions"`
+	// Verification is the policy for checking generated proofs: "none",
+	// "native" (the default) or "serialized".
+	Verification string `json:"verification,omitempty" toml:"verification,omitempty"`
+}
+
+type ManifestVersion struct {
+	Name         string   `json:"name" toml:"name"`
+	Filenames    []string `json:"filenames" toml:"filenames"`
+	Fingerprints []string `json:"fingerprints,omitempty" toml:"fingerprints,omitempty"`
+	Deprecated   bool     `json:"deprecated,omitempty" toml:"deprecated,omitempty"`
+}
+
+var registry struct {
+	lock         sync.RWMutex
+	circuits     []*Metadata
+	verification VerificationOverrides
+}
+
+// defaults returns the compiled-in circuit metadata.
+func defaults() []*Metadata {
+	return []*Metadata{
+		Secp256k1AccountMetadata,
+		WebauthnAccountMetadata,
+		Secp256k1AccountBn254Metadata,
+		WebauthnAccountBn254Metadata,
+		AccountAggregateMetadata,
+		AccountWrapperMetadata,
+	}
+}
+
+// ParseManifest decodes a manifest in the given format, "json" or "toml".
+func ParseManifest(data []byte, format string) (*Manifest, error) {
+	m := &Manifest{}
+	var err error
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "json":
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(m)
+	case "toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), m)
+		if err == nil && len(md.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown key %q", md.Undecoded()[0].String())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported manifest format %q, expected json or toml", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Validate checks that the manifest is internally consistent and compatible
+// with the compiled-in circuit definitions it overrides.
+func (m *Manifest) Validate() error {
+	var errs []string
+	ids := make(map[string]bool)
+	filenames := make(map[string]string)
+	for i, c := range m.Circuits {
+		prefix := fmt.Sprintf("circuits[%d]", i)
+		if c.Id == "" {
+			errs = append(errs, prefix+": id must not be empty")
+		} else {
+			prefix = fmt.Sprintf("circuit %s", c.Id)
+		}
+		if ids[c.Id] {
+			errs = append(errs, prefix+": duplicate id")
+		}
+		ids[c.Id] = true
+
+		field, err := supportedField(c.Curve)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: curve: %v", prefix, err))
+		}
+		if _, err := supportedField(c.Outer); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: outer: %v", prefix, err))
+		}
+		for _, d := range defaults() {
+			if d.Id == c.Id && field != nil && d.Field.Cmp(field) != 0 {
+				errs = append(errs, fmt.Sprintf("%s: curve %s does not match the compiled-in definition on %s", prefix, c.Curve, d.Curve()))
+			}
+		}
+		if c.Commitments < 0 {
+			errs = append(errs, prefix+": commitments must not be negative")
+		}
+		if c.Verification != "" {
+			if _, err := ParseVerification(c.Verification); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", prefix, err))
+			}
+		}
+		if len(c.Versions) == 0 {
+			errs = append(errs, prefix+": at least one version is required")
+		}
+
+		names := make(map[string]bool)
+		for j, v := range c.Versions {
+			vprefix := fmt.Sprintf("%s: versions[%d]", prefix, j)
+			if v.Name == "" {
+				errs = append(errs, vprefix+": name must not be empty")
+			} else if names[v.Name] {
+				errs = append(errs, vprefix+": duplicate name "+v.Name)
+			}
+			names[v.Name] = true
+			if len(v.Filenames) == 0 {
+				errs = append(errs, vprefix+": at least one filename is required")
+			}
+			if !c.MultiTx && len(v.Filenames) > 1 {
+				errs = append(errs, vprefix+": only MultiTx circuits can have several filenames")
+			}
+			if len(v.Fingerprints) > 0 && len(v.Fingerprints) != len(v.Filenames) {
+				errs = append(errs, vprefix+": fingerprints must match filenames one to one")
+			}
+			for _, f := range v.Filenames {
+				if f == "" || strings.ContainsAny(f, "/\\") || f == "." || f == ".." {
+					errs = append(errs, fmt.Sprintf("%s: invalid filename %q", vprefix, f))
+				} else if other, ok := filenames[f]; ok {
+					errs = append(errs, fmt.Sprintf("%s: filename %s is also used by %s", vprefix, f, other))
+				}
+				filenames[f] = c.Id
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid circuit manifest: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ApplyManifest validates a manifest and makes its circuits the ones returned
+// by All and ById. Circuits with the id of a compiled-in circuit replace its
+// metadata but keep its definition; compiled-in circuits missing from the
+// manifest keep their defaults. It is safe to call while proofs are running.
+func ApplyManifest(m *Manifest) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	var list []*Metadata
+	applied := make(map[string]bool)
+	for _, d := range defaults() {
+		c := *d
+		for _, mc := range m.Circuits {
+			if mc.Id == d.Id {
+				c = mc.metadata()
+				c.Inner = d.Inner
+				c.Definition = d.Definition
+				applied[mc.Id] = true
+			}
+		}
+		list = append(list, &c)
+	}
+	for _, mc := range m.Circuits {
+		if !applied[mc.Id] {
+			c := mc.metadata()
+			list = append(list, &c)
+		}
+	}
+
+	registry.lock.Lock()
+	registry.circuits = list
+	registry.lock.Unlock()
+	return nil
+}
+
+// ManifestOf describes the given circuits as a manifest.
+func ManifestOf(ms []*Metadata) *Manifest {
+	m := &Manifest{}
+	for _, c := range ms {
+		mc := ManifestCircuit{
+			Id:           c.Id,
+			Curve:        c.Curve().String(),
+			Outer:        FieldCurve(c.Outer).String(),
+			Commitments:  c.Commitments,
+			MultiTx:      c.MultiTx,
+			Solidity:     c.Solidity,
+			Verification: string(c.Verification),
+		}
+		for _, v := range c.Versions {
+			mc.Versions = append(mc.Versions, ManifestVersion{
+				Name:         v.Name,
+				Filenames:    v.Filenames,
+				Fingerprints: v.Fingerprints,
+				Deprecated:   v.Deprecated,
+			})
+		}
+		m.Circuits = append(m.Circuits, mc)
+	}
+	return m
+}
+
+func (mc ManifestCircuit) metadata() Metadata {
+	field, _ := supportedField(mc.Curve)
+	outer, _ := supportedField(mc.Outer)
+	c := Metadata{
+		Id:           mc.Id,
+		Field:        field,
+		Outer:        outer,
+		Commitments:  mc.Commitments,
+		MultiTx:      mc.MultiTx,
+		Solidity:     mc.Solidity,
+		Verification: Verification(mc.Verification),
+	}
+	for _, v := range mc.Versions {
+		c.Versions = append(c.Versions, &Version{
+			Name:         v.Name,
+			Filenames:    v.Filenames,
+			Fingerprints: v.Fingerprints,
+			Deprecated:   v.Deprecated,
+		})
+	}
+	return c
+}
+
+// supportedField returns the scalar field of a curve the service can load
+// circuits for.
+func supportedField(curve string) (*big.Int, error) {
+	id, err := ecc.IDFromString(curve)
+	if err != nil {
+		return nil, err
+	}
+	switch id {
+	case ecc.BLS12_377, ecc.BN254, ecc.BW6_761:
+		return id.ScalarField(), nil
+	}
+	return nil, fmt.Errorf("unsupported curve %s", curve)
+}
@@ -1,14 +1,17 @@
 package circuits
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/plonk"
 	pbls12377 "github.com/consensys/gnark/backend/plonk/bls12-377"
 	pbn254 "github.com/consensys/gnark/backend/plonk/bn254"
 	pbw6761 "github.com/consensys/gnark/backend/plonk/bw6-761"
+	"github.com/consensys/gnark/frontend"
 )
 
 type Metadata struct {
@@ -18,14 +21,243 @@ type Metadata struct {
 	Commitments int
 	MultiTx     bool
 	Solidity    bool
-	Filenames   []string
+	// Versions lists the compiled releases of the circuit, oldest first.
+	Versions []*Version
+	// Inner is the id of the circuit whose proofs this circuit verifies, for
+	// the stages of the aggregation pipeline.
+	Inner string
+	// Definition returns an empty instance of the circuit with txCount
+	// transactions, for compiling it. Circuits with an Inner circuit are given
+	// the verifying key of the inner circuit they verify, nil otherwise.
+	Definition func(txCount int, inner plonk.VerifyingKey) (frontend.Circuit, error)
+	// Verification is how proofs are checked after they are generated; empty
+	// means VerifyNative.
+	Verification Verification
 }
 
-func (c *Metadata) Filename(txCount int) string {
-	if !c.MultiTx {
+// Verification is a policy for checking proofs right after they are
+// generated, before they are returned.
+type Verification string
+
+const (
+	// VerifyNone trusts the prover and skips verification, for trusted
+	// environments where latency matters more.
+	VerifyNone Verification = "none"
+	// VerifyNative verifies proofs with gnark.
+	VerifyNative Verification = "native"
+	// VerifySerialized verifies proofs after a round trip of the proof and
+	// verifying key through the serialization of their curve, catching
+	// serialization bugs before responses leave the service.
+	VerifySerialized Verification = "serialized"
+)
+
+// ParseVerification returns the verification policy with the given name.
+func ParseVerification(name string) (Verification, error) {
+	switch v := Verification(name); v {
+	case VerifyNone, VerifyNative, VerifySerialized:
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown verification policy %q, expected none, native or serialized", name)
+}
+
+// VerificationOverrides are verification policies that take precedence over
+// those of the circuits, by circuit id; the empty id applies to every circuit
+// without an override of its own.
+type VerificationOverrides map[string]Verification
+
+// ParseVerificationOverrides parses policies given as "<policy>" for every
+// circuit or "<id>=<policy>" for one circuit.
+func ParseVerificationOverrides(values []string) (VerificationOverrides, error) {
+	overrides := make(VerificationOverrides)
+	for _, value := range values {
+		id, name, ok := strings.Cut(value, "=")
+		if !ok {
+			id, name = "", value
+		}
+		v, err := ParseVerification(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		id = strings.TrimSpace(id)
+		if _, dup := overrides[id]; dup {
+			return nil, fmt.Errorf("duplicate verification policy for %q", value)
+		}
+		overrides[id] = v
+	}
+	return overrides, nil
+}
+
+// OverrideVerification sets the verification policy overrides, which survive
+// applying a new manifest.
+func OverrideVerification(overrides VerificationOverrides) {
+	registry.lock.Lock()
+	registry.verification = overrides
+	registry.lock.Unlock()
+}
+
+func verificationOverride(id string) (Verification, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	if v, ok := registry.verification[id]; ok {
+		return v, true
+	}
+	v, ok := registry.verification[""]
+	return v, ok
+}
+
+// Version is one compiled release of a circuit. Keys created with an older
+// verifying key can only be recovered with the matching version, so versions
+// are kept side by side rather than replaced.
+type Version struct {
+	Name string
+	// Filenames holds one compiled circuit per tx count, each named after the
+	// hex keccak256 hash of its onchain verifying key.
+	Filenames []string
+	// Fingerprints records, for each of Filenames, the fingerprint of the
+	// compiled constraint system. Empty entries are not verified.
+	Fingerprints []string
+	// Deprecated versions can still be selected but log a warning.
+	Deprecated bool
+}
+
+// ErrTxCount is returned when a circuit has no compiled variant for the
+// requested number of transactions.
+var ErrTxCount = errors.New("unsupported transaction count")
+
+// Selection picks a compiled circuit. The version is chosen by name if
+// Version is set, otherwise by the verifying key hash a Keyspace key was
+// created with, otherwise the latest version is used. TxCount picks the
+// variant of a MultiTx circuit; zero means a single transaction.
+//
+// The version is never derived from the Keyspace key itself: the key commits
+// to the verifying key and data the keystore was created with, which are not
+// part of a request and no longer match once the keystore is updated, so the
+// current verifying key can't be recovered from it. Clients that know it pass
+// its hash as VkHash.
+type Selection struct {
+	Version string
+	VkHash  string
+	TxCount int
+}
+
+// All returns the metadata of every circuit known to the service: the
+// compiled-in circuits, or those of the manifest applied with ApplyManifest.
+func All() []*Metadata {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	if registry.circuits == nil {
+		return defaults()
+	}
+	return append([]*Metadata(nil), registry.circuits...)
+}
+
+// ById returns the metadata of the circuit with the given id.
+func ById(id string) (*Metadata, error) {
+	for _, m := range All() {
+		if m.Id == id {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown circuit %q", id)
+}
+
+// FingerprintOf returns the fingerprint recorded for a compiled circuit file.
+func FingerprintOf(filename string) (string, bool) {
+	for _, m := range All() {
+		for _, v := range m.Versions {
+			for i, f := range v.Filenames {
+				if f == filename && i < len(v.Fingerprints) && v.Fingerprints[i] != "" {
+					return v.Fingerprints[i], true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// Latest returns the most recent version of the circuit.
+func (c *Metadata) Latest() (*Version, error) {
+	if len(c.Versions) == 0 {
+		return nil, fmt.Errorf("circuit %s has no compiled versions", c.Id)
+	}
+	return c.Versions[len(c.Versions)-1], nil
+}
+
+// Version returns the version of the circuit with the given name.
+func (c *Metadata) Version(name string) (*Version, error) {
+	for _, v := range c.Versions {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown version %q of circuit %s", name, c.Id)
+}
+
+// VersionByVkHash returns the version of the circuit with a compiled circuit
+// whose verifying key has the given hash, with or without a 0x prefix.
+func (c *Metadata) VersionByVkHash(vkHash string) (*Version, error) {
+	vkHash = strings.TrimPrefix(strings.ToLower(vkHash), "0x")
+	for _, v := range c.Versions {
+		for _, f := range v.Filenames {
+			if f == vkHash {
+				return v, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no version of circuit %s has vk hash 0x%s", c.Id, vkHash)
+}
+
+// Select returns the version picked by sel.
+func (c *Metadata) Select(sel Selection) (*Version, error) {
+	if sel.Version != "" {
+		return c.Version(sel.Version)
+	}
+	if sel.VkHash != "" {
+		return c.VersionByVkHash(sel.VkHash)
+	}
+	return c.Latest()
+}
+
+// Filename returns the compiled circuit of version v for txCount
+// transactions, counting from 1. Zero is treated as a single transaction.
+func (c *Metadata) Filename(v *Version, txCount int) (string, error) {
+	if txCount == 0 {
 		txCount = 1
 	}
-	return c.Filenames[txCount-1]
+	if !c.MultiTx && txCount != 1 {
+		return "", fmt.Errorf("%w: circuit %s only proves a single transaction, got %d", ErrTxCount, c.Id, txCount)
+	}
+	if txCount < 1 || txCount > len(v.Filenames) {
+		return "", fmt.Errorf("%w: version %s of circuit %s supports 1 to %d transactions, got %d", ErrTxCount, v.Name, c.Id, len(v.Filenames), txCount)
+	}
+	return v.Filenames[txCount-1], nil
+}
+
+// VerificationPolicy returns how proofs of the circuit are checked: the
+// override set with OverrideVerification if any, otherwise the circuit's own.
+func (c *Metadata) VerificationPolicy() Verification {
+	if v, ok := verificationOverride(c.Id); ok {
+		return v
+	}
+	if c.Verification == "" {
+		return VerifyNative
+	}
+	return c.Verification
+}
+
+// Curve returns the curve whose scalar field is the circuit's field.
+func (c *Metadata) Curve() ecc.ID {
+	return FieldCurve(c.Field)
+}
+
+// FieldCurve returns the curve whose scalar field is field.
+func FieldCurve(field *big.Int) ecc.ID {
+	for _, id := range ecc.Implemented() {
+		if id.ScalarField().Cmp(field) == 0 {
+			return id
+		}
+	}
+	return ecc.UNKNOWN
 }
 
 func (c *Metadata) EmptyProof() (plonk.Proof, error) {
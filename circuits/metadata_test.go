@@ -0,0 +1,113 @@
+package circuits
+
+import (
+	"errors"
+	"testing"
+)
+
+func testMetadata() *Metadata {
+	return &Metadata{
+		Id: "Test",
+		Versions: []*Version{
+			{Name: "v1", Filenames: []string{"aa11"}, Deprecated: true},
+			{Name: "v2", Filenames: []string{"bb22"}},
+		},
+	}
+}
+
+func TestSelect(t *testing.T) {
+	m := testMetadata()
+	for _, tt := range []struct {
+		sel      Selection
+		expected string
+	}{
+		{Selection{}, "v2"},
+		{Selection{Version: "v1"}, "v1"},
+		{Selection{VkHash: "aa11"}, "v1"},
+		{Selection{VkHash: "0xAA11"}, "v1"},
+		// An explicit version takes precedence over the vk hash.
+		{Selection{Version: "v2", VkHash: "aa11"}, "v2"},
+	} {
+		v, err := m.Select(tt.sel)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.sel, err)
+		}
+		if v.Name != tt.expected {
+			t.Errorf("%+v: got %s, expected %s", tt.sel, v.Name, tt.expected)
+		}
+	}
+	for _, sel := range []Selection{{Version: "v3"}, {VkHash: "cc33"}} {
+		if _, err := m.Select(sel); err == nil {
+			t.Errorf("%+v: expected an error", sel)
+		}
+	}
+	if _, err := (&Metadata{Id: "Empty"}).Select(Selection{}); err == nil {
+		t.Error("selected a version of a circuit without versions")
+	}
+}
+
+func TestFilename(t *testing.T) {
+	v := &Version{Name: "v1", Filenames: []string{"one", "two", "three"}}
+	multi := &Metadata{Id: "Multi", MultiTx: true, Versions: []*Version{v}}
+	single := &Metadata{Id: "Single", Versions: []*Version{v}}
+	for _, tt := range []struct {
+		m        *Metadata
+		txCount  int
+		expected string
+	}{
+		{multi, 0, "one"},
+		{multi, 1, "one"},
+		{multi, 3, "three"},
+		{single, 0, "one"},
+		{single, 1, "one"},
+	} {
+		filename, err := tt.m.Filename(v, tt.txCount)
+		if err != nil {
+			t.Fatalf("%s with %d transactions: %v", tt.m.Id, tt.txCount, err)
+		}
+		if filename != tt.expected {
+			t.Errorf("%s with %d transactions: got %s, expected %s", tt.m.Id, tt.txCount, filename, tt.expected)
+		}
+	}
+	for _, tt := range []struct {
+		m       *Metadata
+		txCount int
+	}{
+		{multi, -1},
+		{multi, 4},
+		{single, 2},
+		{single, -1},
+	} {
+		if _, err := tt.m.Filename(v, tt.txCount); !errors.Is(err, ErrTxCount) {
+			t.Errorf("%s with %d transactions: got %v, expected %v", tt.m.Id, tt.txCount, err, ErrTxCount)
+		}
+	}
+}
+
+func TestVerificationOverrides(t *testing.T) {
+	overrides, err := ParseVerificationOverrides([]string{"none", "a=serialized"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	OverrideVerification(overrides)
+	defer OverrideVerification(nil)
+
+	a := &Metadata{Id: "a", Verification: VerifyNative}
+	b := &Metadata{Id: "b", Verification: VerifySerialized}
+	if v := a.VerificationPolicy(); v != VerifySerialized {
+		t.Errorf("a: got %q", v)
+	}
+	if v := b.VerificationPolicy(); v != VerifyNone {
+		t.Errorf("b: got %q", v)
+	}
+	OverrideVerification(nil)
+	if v := b.VerificationPolicy(); v != VerifySerialized {
+		t.Errorf("b without overrides: got %q", v)
+	}
+
+	for _, values := range [][]string{{"fast"}, {"a=none", "a=native"}, {"none", "serialized"}} {
+		if _, err = ParseVerificationOverrides(values); err == nil {
+			t.Errorf("%q: expected an error", values)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package circuits
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/lookup/logderivlookup"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/permutation/sha2"
+	"github.com/consensys/gnark/std/selector"
+)
+
+const (
+	base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	// challengeSize is the length of the unpadded base64url encoding of the
+	// 32-byte challenge.
+	challengeSize = 43
+	// clientDataBlocks is the number of SHA-256 blocks covering the prefix,
+	// challenge and padded suffix of the clientDataJSON.
+	clientDataBlocks = (len(ClientDataJSONPrefix) + challengeSize + len(WebauthnAccount{}.PaddedClientDataSuffix)) / 64
+)
+
+var sha256IV = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A, 0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+// base64URLChallenge encodes the new key as the unpadded base64url encoding of
+// its 32-byte big-endian representation, which is the WebAuthn challenge.
+func base64URLChallenge(api frontend.API, uapi *uints.BinaryField[uints.U32], newKey frontend.Variable) []uints.U8 {
+	bits := api.ToBinary(newKey, newKeyBits)
+	// msb returns bit i of the 256-bit big-endian encoding.
+	msb := func(i int) frontend.Variable {
+		if i >= 256 || 255-i >= newKeyBits {
+			return 0
+		}
+		return bits[255-i]
+	}
+
+	alphabet := logderivlookup.New(api)
+	for _, c := range []byte(base64URLAlphabet) {
+		alphabet.Insert(c)
+	}
+	indices := make([]frontend.Variable, challengeSize)
+	for k := range indices {
+		var v frontend.Variable = 0
+		for j := 0; j < 6; j++ {
+			v = api.Add(v, api.Mul(msb(6*k+j), 1<<(5-j)))
+		}
+		indices[k] = v
+	}
+	chars := alphabet.Lookup(indices...)
+	res := make([]uints.U8, challengeSize)
+	for i, c := range chars {
+		res[i] = uapi.ByteValueOf(c)
+	}
+	return res
+}
+
+// clientDataHash computes the SHA-256 hash of the clientDataJSON, whose padded
+// encoding spans blockCount blocks.
+func clientDataHash(api frontend.API, uapi *uints.BinaryField[uints.U32], challenge []uints.U8, paddedSuffix []uints.U8, blockCount frontend.Variable) []uints.U8 {
+	message := uints.NewU8Array([]byte(ClientDataJSONPrefix))
+	message = append(message, challenge...)
+	message = append(message, paddedSuffix...)
+
+	digest := uints.NewU32Array(sha256IV[:])
+	var state [8]uints.U32
+	copy(state[:], digest)
+	digests := make([][]uints.U8, clientDataBlocks)
+	for i := range digests {
+		var block [64]uints.U8
+		copy(block[:], message[i*64:(i+1)*64])
+		state = sha2.Permute(uapi, state, block)
+		for _, s := range state {
+			digests[i] = append(digests[i], uapi.UnpackMSB(s)...)
+		}
+	}
+
+	// Select the digest after the last block of the padded message.
+	sel := api.Sub(blockCount, 1)
+	res := make([]uints.U8, 32)
+	for i := range res {
+		inputs := make([]frontend.Variable, len(digests))
+		for j := range digests {
+			inputs[j] = digests[j][i].Val
+		}
+		res[i] = uapi.ByteValueOf(selector.Mux(api, sel, inputs...))
+	}
+	return res
+}
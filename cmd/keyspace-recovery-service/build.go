@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"go/format"
+	"os"
+	"slices"
+	"text/template"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
+	"github.com/base-org/keyspace-recovery-service/signatures"
+	"github.com/consensys/gnark/backend/plonk"
+	pbls12377 "github.com/consensys/gnark/backend/plonk/bls12-377"
+	"github.com/consensys/gnark/constraint"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	SRSFlag = &cli.StringFlag{
+		Name:  "srs",
+		Usage: "Path to a canonical KZG SRS for the circuit's curve",
+	}
+	UnsafeTestSRSFlag = &cli.BoolFlag{
+		Name:  "unsafe-test-srs",
+		Usage: "Generate an insecure SRS instead of reading --srs; only for testing",
+	}
+	BuildVersionFlag = &cli.StringFlag{
+		Name:  "circuit-version",
+		Usage: "Name of the version to record for newly built circuits; defaults to the next vN",
+	}
+	DeprecatePreviousFlag = &cli.BoolFlag{
+		Name:  "deprecate-previous",
+		Usage: "Mark every other version of the built circuits as deprecated",
+	}
+	MaxBatchSizeFlag = &cli.IntFlag{
+		Name:  "max-batch-size",
+		Usage: "Number of variants to build for MultiTx circuits, one per batch size from 1",
+		Value: 1,
+	}
+	FilenamesOutFlag = &cli.StringFlag{
+		Name:  "filenames-out",
+		Usage: "Path of the generated circuits/filenames.go to update with the built versions, e.g. circuits/filenames.go; not allowed with --unsafe-test-srs",
+	}
+)
+
+var filenamesTemplate = template.Must(template.New("filenames").Parse(`// Code generated by keyspace-recovery-service circuits build. DO NOT EDIT.
+
+package circuits
+
+func init() {
+{{- range .}}
+	{{.Id}}Metadata.Versions = []*Version{
+	{{- range .Versions}}
+		{
+			Name: {{printf "%q" .Name}},
+			Filenames: []string{
+			{{- range .Filenames}}
+				{{printf "%q" .}},
+			{{- end}}
+			},
+			{{- if .Fingerprints}}
+			Fingerprints: []string{
+			{{- range .Fingerprints}}
+				{{printf "%q" .}},
+			{{- end}}
+			},
+			{{- end}}
+			{{- if .Deprecated}}
+			Deprecated: true,
+			{{- end}}
+		},
+	{{- end}}
+	}
+{{- end}}
+}
+`))
+
+// buildCircuits compiles the given circuits (or all of them), runs the PLONK
+// setup and writes the resulting artifacts to the circuit storage, named after
+// the hash of their verifying key.
+func buildCircuits(cliCtx *cli.Context) error {
+	srsPath := cliCtx.String(SRSFlag.Name)
+	unsafeSRS := cliCtx.Bool(UnsafeTestSRSFlag.Name)
+	if (srsPath == "") == !unsafeSRS {
+		return fmt.Errorf("exactly one of --%s and --%s is required", SRSFlag.Name, UnsafeTestSRSFlag.Name)
+	}
+	// Recording keys from an insecure SRS would make the server use them.
+	out := cliCtx.String(FilenamesOutFlag.Name)
+	if unsafeSRS && out != "" {
+		return fmt.Errorf("--%s cannot record circuits built with --%s", FilenamesOutFlag.Name, UnsafeTestSRSFlag.Name)
+	}
+
+	metadata, err := circuitArgs(cliCtx)
+	if err != nil {
+		return err
+	}
+
+	store, err := newStorage(cliCtx)
+	if err != nil {
+		return err
+	}
+	for _, cm := range metadata {
+		if cm.Definition == nil {
+			log.Warn("Skipping circuit without a compiled-in definition", "id", cm.Id)
+			continue
+		}
+		variants := 1
+		if cm.MultiTx {
+			variants = cliCtx.Int(MaxBatchSizeFlag.Name)
+		}
+		var filenames, fingerprints []string
+		for txCount := 1; txCount <= variants; txCount++ {
+			filename, fingerprint, err := buildCircuit(store, cm, txCount, srsPath)
+			if err != nil {
+				return err
+			}
+			filenames = append(filenames, filename)
+			fingerprints = append(fingerprints, fingerprint)
+		}
+		version, err := recordVersion(cm, cliCtx.String(BuildVersionFlag.Name), filenames, fingerprints, cliCtx.Bool(DeprecatePreviousFlag.Name))
+		if err != nil {
+			return err
+		}
+		log.Info("Built circuit", "id", cm.Id, "version", version.Name, "filenames", filenames, "fingerprints", fingerprints)
+	}
+
+	if out != "" {
+		if err = writeFilenames(out); err != nil {
+			return err
+		}
+		log.Info("Updated circuit filenames", "path", out)
+	}
+	return nil
+}
+
+// buildCircuit compiles the variant of a circuit for txCount transactions,
+// runs the setup and stores the artifacts. It returns their filename and the
+// fingerprint of the constraint system.
+func buildCircuit(store storage.Storage, cm *circuits.Metadata, txCount int, srsPath string) (string, string, error) {
+	inner, err := innerVk(store, cm, txCount)
+	if err != nil {
+		return "", "", err
+	}
+	circuit, err := cm.Definition(txCount, inner)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to define %s: %w", cm.Id, err)
+	}
+	log.Info("Compiling circuit", "id", cm.Id, "curve", cm.Curve(), "txCount", txCount)
+	ccs, err := proving.Compile(circuit, cm.Field)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to compile %s: %w", cm.Id, err)
+	}
+	// Proofs and verifying keys are serialized with a fixed number of
+	// commitments, so artifacts with another count could never be served.
+	if n := len(ccs.GetCommitments().CommitmentIndexes()); n != cm.Commitments {
+		return "", "", fmt.Errorf("%s compiles to %d commitments, its metadata expects %d", cm.Id, n, cm.Commitments)
+	}
+
+	fingerprint, err := proving.Fingerprint(ccs)
+	if err != nil {
+		return "", "", err
+	}
+
+	log.Info("Running setup", "id", cm.Id, "txCount", txCount, "constraints", ccs.GetNbConstraints())
+	c, err := setupCircuit(ccs, srsPath)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to set up %s: %w", cm.Id, err)
+	}
+
+	filename, err := vkFilename(c.Vk)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to hash %s verifying key: %w", cm.Id, err)
+	}
+	if err = proving.Store(store, filename, c); err != nil {
+		return "", "", err
+	}
+	return filename, fingerprint, nil
+}
+
+// innerVk loads the verifying key of the latest version of the circuit that
+// cm verifies, for its variant with txCount transactions. It returns nil for
+// circuits without an inner circuit.
+func innerVk(store storage.Storage, cm *circuits.Metadata, txCount int) (plonk.VerifyingKey, error) {
+	if cm.Inner == "" {
+		return nil, nil
+	}
+	inner, err := circuits.ById(cm.Inner)
+	if err != nil {
+		return nil, err
+	}
+	v, err := inner.Latest()
+	if err != nil {
+		return nil, fmt.Errorf("%s verifies %s, which must be built first: %w", cm.Id, inner.Id, err)
+	}
+	if !inner.MultiTx {
+		txCount = 1
+	}
+	filename, err := inner.Filename(v, txCount)
+	if err != nil {
+		return nil, err
+	}
+	_, _, vk, err := proving.Load(store, filename, inner.Field, true, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load %s verifying key: %w", inner.Id, err)
+	}
+	return vk, nil
+}
+
+// recordVersion adds a built circuit to the metadata as a new version, or
+// updates the version that already has the same verifying keys.
+func recordVersion(cm *circuits.Metadata, name string, filenames, fingerprints []string, deprecatePrevious bool) (*circuits.Version, error) {
+	var version *circuits.Version
+	for _, v := range cm.Versions {
+		if slices.Equal(v.Filenames, filenames) {
+			version = v
+		}
+	}
+	if version == nil {
+		if name == "" {
+			name = fmt.Sprintf("v%d", len(cm.Versions)+1)
+		}
+		if _, err := cm.Version(name); err == nil {
+			return nil, fmt.Errorf("version %s of circuit %s already exists with a different verifying key", name, cm.Id)
+		}
+		version = &circuits.Version{Name: name, Filenames: filenames}
+		cm.Versions = append(cm.Versions, version)
+	}
+	version.Fingerprints = fingerprints
+	if deprecatePrevious {
+		for _, v := range cm.Versions {
+			v.Deprecated = v != version
+		}
+	}
+	return version, nil
+}
+
+// vkFilename names circuit artifacts after the hash of their verifying key:
+// the onchain VkHash where the key has the layout expected onchain, otherwise
+// the keccak256 hash of its binary encoding.
+func vkFilename(vk plonk.VerifyingKey) (string, error) {
+	if bls12377vk, ok := vk.(*pbls12377.VerifyingKey); ok {
+		if vkBytes, err := signatures.VkToBytes(bls12377vk); err == nil {
+			return hex.EncodeToString(signatures.VkHash(vkBytes).Bytes()), nil
+		}
+		log.Warn("Verifying key does not have the onchain layout, naming it after its binary encoding")
+	}
+	var buf bytes.Buffer
+	if _, err := vk.WriteTo(&buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(crypto.Keccak256(buf.Bytes())), nil
+}
+
+// setupCircuit runs the PLONK setup with the SRS at srsPath, or with an
+// insecure test SRS if srsPath is empty.
+func setupCircuit(ccs constraint.ConstraintSystem, srsPath string) (*proving.CompiledCircuit, error) {
+	if srsPath == "" {
+		return proving.Setup(ccs, nil)
+	}
+	f, err := os.Open(srsPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open SRS: %w", err)
+	}
+	defer f.Close()
+	return proving.Setup(ccs, bufio.NewReader(f))
+}
+
+// writeFilenames regenerates circuits/filenames.go from the current metadata
+// of the compiled-in circuits.
+func writeFilenames(path string) error {
+	var compiled []*circuits.Metadata
+	for _, cm := range circuits.All() {
+		if cm.Definition != nil {
+			compiled = append(compiled, cm)
+		}
+	}
+	var buf bytes.Buffer
+	if err := filenamesTemplate.Execute(&buf, compiled); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, src, 0o644)
+}
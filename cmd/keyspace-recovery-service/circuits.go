@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
+	"github.com/consensys/gnark/backend/plonk"
+	pbls12377 "github.com/consensys/gnark/backend/plonk/bls12-377"
+	pbn254 "github.com/consensys/gnark/backend/plonk/bn254"
+	pbw6761 "github.com/consensys/gnark/backend/plonk/bw6-761"
+	"github.com/urfave/cli/v2"
+)
+
+var CircuitsCommand = &cli.Command{
+	Name:  "circuits",
+	Usage: "Inspect and build the compiled circuits",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  "List the circuits known to the service",
+			Action: listCircuits,
+		},
+		{
+			Name:      "inspect",
+			Usage:     "Load a circuit's constraint system and verifying key and print their parameters",
+			ArgsUsage: "<id>",
+			Action:    inspectCircuit,
+		},
+		{
+			Name:      "build",
+			Usage:     "Compile circuits, run the PLONK setup and write their artifacts to the circuit path",
+			ArgsUsage: "[<id>...]",
+			Flags:     []cli.Flag{SRSFlag, UnsafeTestSRSFlag, BuildVersionFlag, DeprecatePreviousFlag, MaxBatchSizeFlag, FilenamesOutFlag},
+			Action:    buildCircuits,
+		},
+		{
+			Name:      "fingerprint",
+			Usage:     "Recompute the fingerprint of stored constraint systems and compare it with the recorded one",
+			ArgsUsage: "[<id>...]",
+			Flags:     []cli.Flag{SourceFlag, SRSFlag},
+			Action:    fingerprintCircuits,
+		},
+		{
+			Name:      "compress",
+			Usage:     "Write compressed copies of circuit artifacts, which are loaded transparently, and print their SHA-256",
+			ArgsUsage: "[<id>...]",
+			Flags:     []cli.Flag{CompressionFlag, DeleteUncompressedFlag, ChecksumsOutFlag},
+			Action:    compressCircuits,
+		},
+		{
+			Name:   "manifest",
+			Usage:  "Print the known circuits as a manifest for --circuit-manifest",
+			Flags:  []cli.Flag{ManifestFormatFlag},
+			Action: printManifest,
+		},
+	},
+}
+
+func listCircuits(cliCtx *cli.Context) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCURVE\tOUTER\tCOMMITMENTS\tMULTITX\tSOLIDITY\tVERSION\tDEPRECATED\tFILENAMES\tFINGERPRINTS")
+	for _, m := range circuits.All() {
+		for _, v := range m.Versions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%t\t%t\t%s\t%t\t%v\t%v\n", m.Id, m.Curve(), circuits.FieldCurve(m.Outer), m.Commitments, m.MultiTx, m.Solidity, v.Name, v.Deprecated, v.Filenames, v.Fingerprints)
+		}
+	}
+	return w.Flush()
+}
+
+func inspectCircuit(cliCtx *cli.Context) error {
+	cm, err := circuitArg(cliCtx)
+	if err != nil {
+		return err
+	}
+	store, err := newStorage(cliCtx)
+	if err != nil {
+		return err
+	}
+	first := true
+	for _, v := range cm.Versions {
+		for _, filename := range v.Filenames {
+			if !first {
+				fmt.Println()
+			}
+			first = false
+			if err = inspectFile(store, cm, v, filename); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func inspectFile(store storage.Storage, cm *circuits.Metadata, v *circuits.Version, filename string) error {
+	ccs, vk, err := proving.LoadWithoutPk(store, filename, cm.Field, nil)
+	if err != nil {
+		return fmt.Errorf("unable to load %s: %w", filename, err)
+	}
+	internal, secret, public := ccs.GetNbVariables()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "id:\t%s\n", cm.Id)
+	fmt.Fprintf(w, "version:\t%s\n", v.Name)
+	fmt.Fprintf(w, "deprecated:\t%t\n", v.Deprecated)
+	fmt.Fprintf(w, "filename:\t%s\n", filename)
+	fmt.Fprintf(w, "curve:\t%s\n", cm.Curve())
+	fmt.Fprintf(w, "constraints:\t%d\n", ccs.GetNbConstraints())
+	fmt.Fprintf(w, "public inputs:\t%d\n", public)
+	fmt.Fprintf(w, "secret inputs:\t%d\n", secret)
+	fmt.Fprintf(w, "internal variables:\t%d\n", internal)
+	fmt.Fprintf(w, "commitments:\t%d\n", len(ccs.GetCommitments().CommitmentIndexes()))
+	fmt.Fprintf(w, "domain size:\t%d\n", vkDomainSize(vk))
+	fmt.Fprintf(w, "vk public witness:\t%d\n", vk.NbPublicWitness())
+	return w.Flush()
+}
+
+func circuitArg(cliCtx *cli.Context) (*circuits.Metadata, error) {
+	if cliCtx.NArg() != 1 {
+		return nil, errors.New("expected a single circuit id argument, see `circuits list`")
+	}
+	return circuits.ById(cliCtx.Args().First())
+}
+
+// circuitArgs returns the circuits named by the arguments, or all circuits if
+// there are none.
+func circuitArgs(cliCtx *cli.Context) ([]*circuits.Metadata, error) {
+	if cliCtx.NArg() == 0 {
+		return circuits.All(), nil
+	}
+	var metadata []*circuits.Metadata
+	for _, id := range cliCtx.Args().Slice() {
+		cm, err := circuits.ById(id)
+		if err != nil {
+			return nil, err
+		}
+		metadata = append(metadata, cm)
+	}
+	return metadata, nil
+}
+
+func vkDomainSize(vk plonk.VerifyingKey) uint64 {
+	switch vk := vk.(type) {
+	case *pbls12377.VerifyingKey:
+		return vk.Size
+	case *pbn254.VerifyingKey:
+		return vk.Size
+	case *pbw6761.VerifyingKey:
+		return vk.Size
+	}
+	return 0
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	CompressionFlag = &cli.StringFlag{
+		Name:  "compression",
+		Usage: "Compression to use, zstd or gzip",
+		Value: storage.Zstd.Name,
+	}
+	DeleteUncompressedFlag = &cli.BoolFlag{
+		Name:  "delete-uncompressed",
+		Usage: "Delete the uncompressed artifacts once their compressed copy is written",
+	}
+	ChecksumsOutFlag = &cli.StringFlag{
+		Name:  "checksums-out",
+		Usage: "Key to also write the sha256sum lines under in the circuit storage, e.g. SHA256SUMS for --circuit-checksums",
+	}
+)
+
+// compressCircuits writes compressed copies of the artifacts of circuits and
+// prints the SHA-256 of each in sha256sum format.
+func compressCircuits(cliCtx *cli.Context) error {
+	codec, err := storage.CodecByName(cliCtx.String(CompressionFlag.Name))
+	if err != nil {
+		return err
+	}
+	metadata, err := circuitArgs(cliCtx)
+	if err != nil {
+		return err
+	}
+	store, err := newStorage(cliCtx)
+	if err != nil {
+		return err
+	}
+
+	var sums bytes.Buffer
+	for _, cm := range metadata {
+		for _, v := range cm.Versions {
+			for _, filename := range v.Filenames {
+				for _, suffix := range []string{"ccs", "pk", "vk"} {
+					key := fmt.Sprintf("%s.%s", filename, suffix)
+					if _, err := store.Stat(key); errors.Is(err, storage.ErrNotExist) {
+						log.Info("Skipping missing or already compressed artifact", "key", key)
+						continue
+					} else if err != nil {
+						return err
+					}
+					digest, err := compressObject(store, key, codec)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(digest), key+codec.Ext)
+					if cliCtx.Bool(DeleteUncompressedFlag.Name) {
+						if err = store.Delete(key); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if out := cliCtx.String(ChecksumsOutFlag.Name); out != "" {
+		w, err := store.Writer(out)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(sums.Bytes()); err != nil {
+			_ = storage.Abort(w)
+			return err
+		}
+		if err = w.Close(); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(cliCtx.App.Writer, &sums)
+	return err
+}
+
+// compressObject writes key compressed with codec under key plus its
+// extension, returning the SHA-256 of the compressed object.
+func compressObject(store storage.Storage, key string, codec storage.Codec) ([]byte, error) {
+	compressedKey := key + codec.Ext
+	log.Info("Compressing circuit artifact", "key", key, "compression", codec.Name)
+	r, err := store.Reader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	w, err := store.Writer(compressedKey)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, h)}
+	cw, err := codec.NewWriter(counter)
+	if err != nil {
+		_ = storage.Abort(w)
+		return nil, err
+	}
+	n, err := io.Copy(cw, r)
+	if err == nil {
+		err = cw.Close()
+	}
+	if err != nil {
+		_ = storage.Abort(w)
+		return nil, fmt.Errorf("unable to compress %s: %w", key, err)
+	}
+	if err = w.Close(); err != nil {
+		return nil, fmt.Errorf("unable to compress %s: %w", key, err)
+	}
+	log.Info("Compressed circuit artifact", "key", compressedKey, "size", n, "compressed", counter.n)
+	return h.Sum(nil), nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
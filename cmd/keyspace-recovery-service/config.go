@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "<redacted>"
+
+// secretFlags are redacted when dumping the effective configuration.
+var secretFlags = map[string]bool{
+	APIKeysFlag.Name:    true,
+	JWTSecretFlag.Name:  true,
+	StorageKeyFlag.Name: true,
+}
+
+var ConfigCommand = &cli.Command{
+	Name:  "config",
+	Usage: "Inspect the service configuration",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "dump",
+			Usage:  "Print the effective configuration as TOML, with secrets redacted",
+			Action: dumpConfig,
+		},
+	},
+}
+
+// loadConfigFile applies values from the --config file to every flag that
+// was not set on the command line or through the environment, giving the
+// precedence flag > env > file > default.
+func loadConfigFile(cliCtx *cli.Context) error {
+	path := cliCtx.String(ConfigFlag.Name)
+	if path == "" {
+		return nil
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %w", err)
+	}
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(contents, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(contents, &values)
+	default:
+		return fmt.Errorf("unsupported config file format %q, expected .toml, .yaml or .yml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	flags := make(map[string]bool)
+	for _, f := range Flags {
+		flags[f.Names()[0]] = true
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		if !flags[name] || name == ConfigFlag.Name {
+			return fmt.Errorf("unknown key %q in config file %s", name, path)
+		}
+		if cliCtx.IsSet(name) {
+			continue
+		}
+		var items []interface{}
+		if list, ok := values[name].([]interface{}); ok {
+			items = list
+		} else {
+			items = []interface{}{values[name]}
+		}
+		for _, item := range items {
+			if err := cliCtx.Set(name, fmt.Sprint(item)); err != nil {
+				return fmt.Errorf("invalid value for %q in config file %s: %w", name, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateConfig checks the effective configuration before the service starts.
+func validateConfig(cliCtx *cli.Context) error {
+	var errs []error
+	if port := cliCtx.Int(PortFlag.Name); port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("--%s must be between 1 and 65535, got %d", PortFlag.Name, port))
+	}
+	if cliCtx.String(CircuitPathFlag.Name) == "" {
+		errs = append(errs, fmt.Errorf("--%s must not be empty", CircuitPathFlag.Name))
+	}
+	if cliCtx.String(CircuitManifestFlag.Name) != "" && cliCtx.String(CircuitManifestKeyFlag.Name) != "" {
+		errs = append(errs, fmt.Errorf("--%s and --%s are mutually exclusive", CircuitManifestFlag.Name, CircuitManifestKeyFlag.Name))
+	}
+	if n := cliCtx.Int(MaxConcurrentProofsFlag.Name); n < 1 {
+		errs = append(errs, fmt.Errorf("--%s must be at least 1, got %d", MaxConcurrentProofsFlag.Name, n))
+	}
+	if d := cliCtx.Duration(JobRetentionFlag.Name); d <= 0 {
+		errs = append(errs, fmt.Errorf("--%s must be positive, got %s", JobRetentionFlag.Name, d))
+	}
+	for _, f := range []*cli.Float64Flag{KeyRateLimitFlag, IPRateLimitFlag} {
+		if v := cliCtx.Float64(f.Name); v < 0 {
+			errs = append(errs, fmt.Errorf("--%s must not be negative, got %v", f.Name, v))
+		}
+	}
+	for _, f := range []*cli.IntFlag{KeyRateBurstFlag, IPRateBurstFlag} {
+		if v := cliCtx.Int(f.Name); v < 1 {
+			errs = append(errs, fmt.Errorf("--%s must be at least 1, got %d", f.Name, v))
+		}
+	}
+	for _, f := range []*cli.IntFlag{KeyMaxConcurrentJobsFlag, IPMaxConcurrentJobsFlag, MaxSignatureSizeFlag, MaxBatchRequestsFlag} {
+		if v := cliCtx.Int(f.Name); v < 0 {
+			errs = append(errs, fmt.Errorf("--%s must not be negative, got %d", f.Name, v))
+		}
+	}
+	if v := cliCtx.Int(CircuitShardsFlag.Name); v < 0 || v > 8 {
+		errs = append(errs, fmt.Errorf("--%s must be between 0 and 8, got %d", CircuitShardsFlag.Name, v))
+	}
+	for _, f := range []*cli.StringFlag{CircuitFileModeFlag, CircuitDirModeFlag} {
+		if _, err := parseMode(cliCtx.String(f.Name)); err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", f.Name, err))
+		}
+	}
+	if cliCtx.String(CircuitBucketFlag.Name) != "" && cliCtx.String(CircuitURLFlag.Name) != "" {
+		errs = append(errs, fmt.Errorf("--%s and --%s are mutually exclusive", CircuitBucketFlag.Name, CircuitURLFlag.Name))
+	}
+	if cliCtx.String(StorageKeyFlag.Name) != "" && cliCtx.String(StorageKeyFileFlag.Name) != "" {
+		errs = append(errs, fmt.Errorf("--%s and --%s are mutually exclusive", StorageKeyFlag.Name, StorageKeyFileFlag.Name))
+	} else if v := cliCtx.String(StorageKeyFlag.Name); v != "" {
+		if _, err := storage.ParseKey(v); err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", StorageKeyFlag.Name, err))
+		}
+	} else if path := cliCtx.String(StorageKeyFileFlag.Name); path != "" {
+		if _, err := storage.ReadKeyFile(path); err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", StorageKeyFileFlag.Name, err))
+		}
+	}
+	if v := cliCtx.Int64(S3PartSizeFlag.Name); v < 1 {
+		errs = append(errs, fmt.Errorf("--%s must be at least 1, got %d", S3PartSizeFlag.Name, v))
+	}
+	if v := cliCtx.Int(S3ConcurrencyFlag.Name); v < 1 {
+		errs = append(errs, fmt.Errorf("--%s must be at least 1, got %d", S3ConcurrencyFlag.Name, v))
+	}
+	if v := cliCtx.Int(MaxBodySizeFlag.Name); v < 1 {
+		errs = append(errs, fmt.Errorf("--%s must be at least 1, got %d", MaxBodySizeFlag.Name, v))
+	}
+	if len(cliCtx.StringSlice(CORSAllowedMethodsFlag.Name)) == 0 {
+		errs = append(errs, fmt.Errorf("--%s must not be empty", CORSAllowedMethodsFlag.Name))
+	}
+	if (cliCtx.String(TLSCertFlag.Name) == "") != (cliCtx.String(TLSKeyFlag.Name) == "") {
+		errs = append(errs, fmt.Errorf("--%s and --%s must be set together", TLSCertFlag.Name, TLSKeyFlag.Name))
+	}
+	if cliCtx.String(TLSClientCAFlag.Name) != "" && cliCtx.String(TLSCertFlag.Name) == "" {
+		errs = append(errs, fmt.Errorf("--%s requires --%s and --%s", TLSClientCAFlag.Name, TLSCertFlag.Name, TLSKeyFlag.Name))
+	}
+	for _, f := range []*cli.StringFlag{TLSCertFlag, TLSKeyFlag, TLSClientCAFlag} {
+		if path := cliCtx.String(f.Name); path != "" {
+			if _, err := os.Stat(path); err != nil {
+				errs = append(errs, fmt.Errorf("--%s: %w", f.Name, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return errors.New("invalid configuration: " + strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// parseMode parses octal file permissions such as "0640".
+func parseMode(s string) (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0o777 {
+		return 0, fmt.Errorf("invalid permissions %q, expected octal such as 0644", s)
+	}
+	return fs.FileMode(mode), nil
+}
+
+func dumpConfig(cliCtx *cli.Context) error {
+	return writeConfig(cliCtx, os.Stdout)
+}
+
+// writeConfig writes the effective configuration as TOML, with every value
+// in the type its flag parses, so it can be loaded back with --config.
+func writeConfig(cliCtx *cli.Context, w io.Writer) error {
+	values := make(map[string]interface{})
+	for _, f := range Flags {
+		name := f.Names()[0]
+		if name == ConfigFlag.Name {
+			continue
+		}
+		var v interface{}
+		switch f.(type) {
+		case *cli.IntFlag:
+			v = cliCtx.Int(name)
+		case *cli.Int64Flag:
+			v = cliCtx.Int64(name)
+		case *cli.Float64Flag:
+			v = cliCtx.Float64(name)
+		case *cli.BoolFlag:
+			v = cliCtx.Bool(name)
+		case *cli.DurationFlag:
+			v = cliCtx.Duration(name).String()
+		case *cli.StringSliceFlag:
+			v = cliCtx.StringSlice(name)
+		default:
+			v = cliCtx.String(name)
+		}
+		// Empty secrets are kept, so they load back as empty.
+		empty := v == ""
+		if list, ok := v.([]string); ok {
+			empty = len(list) == 0
+		}
+		if secretFlags[name] && !empty {
+			v = redacted
+		}
+		values[name] = v
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(values); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type corsConfig struct {
+	allowedOrigins []string
+	allowedMethods []string
+	allowedHeaders []string
+}
+
+func (c corsConfig) originAllowed(origin string) bool {
+	return slices.Contains(c.allowedOrigins, "*") || slices.ContainsFunc(c.allowedOrigins, func(o string) bool {
+		return strings.EqualFold(o, origin)
+	})
+}
+
+// corsHandler sets CORS headers for allowed origins and answers preflight
+// requests without passing them on to next.
+func corsHandler(cfg corsConfig, next http.Handler) http.Handler {
+	methods := strings.Join(cfg.allowedMethods, ", ")
+	headers := strings.Join(cfg.allowedHeaders, ", ")
+	configured := len(cfg.allowedOrigins) > 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Responses depend on the origin whether or not it is allowed, so a
+		// shared cache must not serve one origin's response to another.
+		if configured {
+			w.Header().Add("Vary", "Origin")
+		}
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && cfg.originAllowed(origin)
+		if allowed {
+			if slices.Contains(cfg.allowedOrigins, "*") {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !allowed || !slices.Contains(cfg.allowedMethods, r.Header.Get("Access-Control-Request-Method")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", methods)
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSVaryOrigin(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		name    string
+		origins []string
+		origin  string
+		vary    bool
+		allow   string
+	}{
+		{"allowed", []string{"https://a.example"}, "https://a.example", true, "https://a.example"},
+		{"disallowed", []string{"https://a.example"}, "https://b.example", true, ""},
+		{"no origin", []string{"https://a.example"}, "", true, ""},
+		{"wildcard", []string{"*"}, "https://b.example", true, "*"},
+		{"not configured", nil, "https://a.example", false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.origin != "" {
+				r.Header.Set("Origin", tc.origin)
+			}
+			w := httptest.NewRecorder()
+			corsHandler(corsConfig{allowedOrigins: tc.origins, allowedMethods: []string{"POST"}}, ok).ServeHTTP(w, r)
+			if vary := w.Header().Get("Vary") == "Origin"; vary != tc.vary {
+				t.Errorf("Vary: got %q", w.Header().Get("Vary"))
+			}
+			if allow := w.Header().Get("Access-Control-Allow-Origin"); allow != tc.allow {
+				t.Errorf("Access-Control-Allow-Origin: got %q, expected %q", allow, tc.allow)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/urfave/cli/v2"
+)
+
+var SourceFlag = &cli.BoolFlag{
+	Name:  "source",
+	Usage: "Also compile the circuit definitions and compare their fingerprint with the latest version; with --srs, also compare their verifying key",
+}
+
+// fingerprintCircuits recomputes the fingerprint of the stored constraint
+// systems and compares them with the fingerprints recorded in the metadata.
+func fingerprintCircuits(cliCtx *cli.Context) error {
+	metadata, err := circuitArgs(cliCtx)
+	if err != nil {
+		return err
+	}
+	store, err := newStorage(cliCtx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "gnark:\t%s\n\n", proving.GnarkVersion())
+	fmt.Fprintln(w, "ID\tVERSION\tSOURCE\tFINGERPRINT\tRECORDED\tMATCH")
+	mismatches := 0
+	// stored holds the fingerprints of the stored constraint systems, which
+	// the source is compared with when none is recorded.
+	stored := make(map[string]string)
+	row := func(cm *circuits.Metadata, version, source, fingerprint, recorded string) {
+		match := "-"
+		if recorded != "" {
+			match = fmt.Sprint(fingerprint == recorded)
+			if fingerprint != recorded {
+				mismatches++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", cm.Id, version, source, fingerprint, recorded, match)
+	}
+	for _, cm := range metadata {
+		for _, v := range cm.Versions {
+			for _, filename := range v.Filenames {
+				ccs, _, err := proving.LoadWithoutPk(store, filename, cm.Field, nil)
+				if err != nil {
+					return fmt.Errorf("unable to load %s: %w", filename, err)
+				}
+				fingerprint, err := proving.Fingerprint(ccs)
+				if err != nil {
+					return err
+				}
+				stored[filename] = fingerprint
+				recorded, _ := circuits.FingerprintOf(filename)
+				row(cm, v.Name, filename, fingerprint, recorded)
+			}
+		}
+		if cliCtx.Bool(SourceFlag.Name) && cm.Definition != nil {
+			inner, err := innerVk(store, cm, 1)
+			if err != nil {
+				return err
+			}
+			circuit, err := cm.Definition(1, inner)
+			if err != nil {
+				return fmt.Errorf("unable to define %s: %w", cm.Id, err)
+			}
+			ccs, err := proving.Compile(circuit, cm.Field)
+			if err != nil {
+				return fmt.Errorf("unable to compile %s: %w", cm.Id, err)
+			}
+			fingerprint, err := proving.Fingerprint(ccs)
+			if err != nil {
+				return err
+			}
+			// The source is expected to match the latest version.
+			v, err := cm.Latest()
+			if err != nil {
+				row(cm, "", "source", fingerprint, "")
+				continue
+			}
+			recorded := stored[v.Filenames[0]]
+			if len(v.Fingerprints) > 0 {
+				recorded = v.Fingerprints[0]
+			}
+			row(cm, v.Name, "source", fingerprint, recorded)
+			// The verifying key depends on the SRS as well, and names the
+			// artifacts.
+			if srsPath := cliCtx.String(SRSFlag.Name); srsPath != "" {
+				c, err := setupCircuit(ccs, srsPath)
+				if err != nil {
+					return fmt.Errorf("unable to set up %s: %w", cm.Id, err)
+				}
+				filename, err := vkFilename(c.Vk)
+				if err != nil {
+					return err
+				}
+				row(cm, v.Name, "source vk", filename, v.Filenames[0])
+			}
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d fingerprints do not match the recorded ones", mismatches)
+	}
+	return nil
+}
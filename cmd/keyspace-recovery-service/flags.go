@@ -1,6 +1,10 @@
 package main
 
 import (
+	"runtime"
+	"time"
+
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
 	"github.com/urfave/cli/v2"
 )
 
@@ -11,6 +15,11 @@ func PrefixEnvVar(suffix string) []string {
 }
 
 var (
+	ConfigFlag = &cli.StringFlag{
+		Name:    "config",
+		Usage:   "TOML or YAML file whose keys mirror the flag names; flags and env vars take precedence",
+		EnvVars: PrefixEnvVar("CONFIG"),
+	}
 	PortFlag = &cli.IntFlag{
 		Name:    "port",
 		Usage:   "Port to run the RPC service on",
@@ -23,9 +32,254 @@ var (
 		EnvVars: PrefixEnvVar("CIRCUIT_PATH"),
 		Value:   "compiled/",
 	}
+	CircuitShardsFlag = &cli.IntFlag{
+		Name:    "circuit-shards",
+		Usage:   "Levels of two-character subdirectories circuit files are spread over in --circuit-path",
+		EnvVars: PrefixEnvVar("CIRCUIT_SHARDS"),
+	}
+	CircuitFileModeFlag = &cli.StringFlag{
+		Name:    "circuit-file-mode",
+		Usage:   "Octal permissions of circuit files written to --circuit-path",
+		EnvVars: PrefixEnvVar("CIRCUIT_FILE_MODE"),
+		Value:   "0644",
+	}
+	CircuitDirModeFlag = &cli.StringFlag{
+		Name:    "circuit-dir-mode",
+		Usage:   "Octal permissions of directories created in --circuit-path",
+		EnvVars: PrefixEnvVar("CIRCUIT_DIR_MODE"),
+		Value:   "0755",
+	}
+	CircuitMmapFlag = &cli.BoolFlag{
+		Name:    "circuit-mmap",
+		Usage:   "Load circuits in --circuit-path from memory-mapped files instead of reading them into the heap",
+		EnvVars: PrefixEnvVar("CIRCUIT_MMAP"),
+	}
+	CircuitBucketFlag = &cli.StringFlag{
+		Name:    "circuit-bucket",
+		Usage:   "S3 bucket to read and write circuit files in, instead of --circuit-path",
+		EnvVars: PrefixEnvVar("CIRCUIT_BUCKET"),
+	}
+	CircuitURLFlag = &cli.StringFlag{
+		Name:    "circuit-url",
+		Usage:   "Base URL to read circuit files from over HTTP, e.g. an IPFS gateway path, instead of --circuit-path",
+		EnvVars: PrefixEnvVar("CIRCUIT_URL"),
+	}
+	CircuitChecksumsFlag = &cli.StringFlag{
+		Name:    "circuit-checksums",
+		Usage:   "Name of a sha256sum file next to the circuit files at --circuit-url to verify downloads against",
+		EnvVars: PrefixEnvVar("CIRCUIT_CHECKSUMS"),
+	}
+	CircuitRequireChecksumFlag = &cli.BoolFlag{
+		Name:    "circuit-require-checksum",
+		Usage:   "Reject circuit files at --circuit-url that can't be verified against --circuit-checksums or their CID, instead of warning",
+		EnvVars: PrefixEnvVar("CIRCUIT_REQUIRE_CHECKSUM"),
+	}
+	S3PartSizeFlag = &cli.Int64Flag{
+		Name:    "s3-part-size",
+		Usage:   "Size in bytes of the ranged GETs circuit files are downloaded from S3 with",
+		EnvVars: PrefixEnvVar("S3_PART_SIZE"),
+		Value:   storage.DefaultS3PartSize,
+	}
+	S3ConcurrencyFlag = &cli.IntFlag{
+		Name:    "s3-concurrency",
+		Usage:   "Number of parts of a circuit file downloaded from S3 at once",
+		EnvVars: PrefixEnvVar("S3_CONCURRENCY"),
+		Value:   storage.DefaultS3Concurrency,
+	}
+	S3MaxRetriesFlag = &cli.IntFlag{
+		Name:    "s3-max-retries",
+		Usage:   "Number of times a failed S3 part download is resumed, -1 to never retry",
+		EnvVars: PrefixEnvVar("S3_MAX_RETRIES"),
+		Value:   storage.DefaultS3MaxRetries,
+	}
+	StorageKeyFlag = &cli.StringFlag{
+		Name:    "storage-key",
+		Usage:   "Hex AES key to encrypt objects in the circuit storage with; prefer --storage-key-file",
+		EnvVars: PrefixEnvVar("STORAGE_KEY"),
+	}
+	StorageKeyFileFlag = &cli.StringFlag{
+		Name:    "storage-key-file",
+		Usage:   "File containing the hex AES key to encrypt objects in the circuit storage with",
+		EnvVars: PrefixEnvVar("STORAGE_KEY_FILE"),
+	}
+	CircuitManifestFlag = &cli.StringFlag{
+		Name:    "circuit-manifest",
+		Usage:   "JSON or TOML circuit manifest file overriding the compiled-in circuits; reloaded on SIGHUP",
+		EnvVars: PrefixEnvVar("CIRCUIT_MANIFEST"),
+	}
+	CircuitManifestKeyFlag = &cli.StringFlag{
+		Name:    "circuit-manifest-key",
+		Usage:   "Like --circuit-manifest, but read from this key in the circuit storage",
+		EnvVars: PrefixEnvVar("CIRCUIT_MANIFEST_KEY"),
+	}
+	VerificationFlag = &cli.StringSliceFlag{
+		Name:    "verification",
+		Usage:   "Verification policy overriding the circuits' own: none, native or serialized for every circuit, or <id>=<policy> for one",
+		EnvVars: PrefixEnvVar("VERIFICATION"),
+	}
+	VerifyCircuitsFlag = &cli.BoolFlag{
+		Name:    "verify-circuits",
+		Usage:   "Check every circuit against its recorded fingerprint at startup and when circuits added by a manifest reload are loaded, failing on a mismatch or a missing fingerprint",
+		EnvVars: PrefixEnvVar("VERIFY_CIRCUITS"),
+	}
+	MaxConcurrentProofsFlag = &cli.IntFlag{
+		Name:    "max-concurrent-proofs",
+		Usage:   "Number of proofs generated in parallel, defaulting to the number of CPUs; further requests are queued",
+		EnvVars: PrefixEnvVar("MAX_CONCURRENT_PROOFS"),
+		Value:   runtime.NumCPU(),
+	}
+	JobRetentionFlag = &cli.DurationFlag{
+		Name:    "job-retention",
+		Usage:   "How long finished job results are kept for recover_jobStatus",
+		EnvVars: PrefixEnvVar("JOB_RETENTION"),
+		Value:   time.Hour,
+	}
+	APIKeysFlag = &cli.StringSliceFlag{
+		Name:    "api-keys",
+		Usage:   "API keys accepted as a bearer token or X-API-Key header, optionally as name:key; enables authentication",
+		EnvVars: PrefixEnvVar("API_KEYS"),
+	}
+	JWTSecretFlag = &cli.StringFlag{
+		Name:    "jwt-secret",
+		Usage:   "HS256 secret for JWT bearer tokens; enables authentication",
+		EnvVars: PrefixEnvVar("JWT_SECRET"),
+	}
+	RealIPHeaderFlag = &cli.StringFlag{
+		Name:    "real-ip-header",
+		Usage:   "Header carrying the client IP, e.g. X-Forwarded-For; only set it behind a proxy that appends to or overwrites it",
+		EnvVars: PrefixEnvVar("REAL_IP_HEADER"),
+	}
+	RealIPHopsFlag = &cli.IntFlag{
+		Name:    "real-ip-hops",
+		Usage:   "Number of trusted proxies appending to --real-ip-header; the client IP is the entry this many from the right",
+		EnvVars: PrefixEnvVar("REAL_IP_HOPS"),
+		Value:   1,
+	}
+	KeyRateLimitFlag = &cli.Float64Flag{
+		Name:    "key-rate-limit",
+		Usage:   "Proofs per minute allowed per API key or JWT subject (0 = unlimited)",
+		EnvVars: PrefixEnvVar("KEY_RATE_LIMIT"),
+	}
+	KeyRateBurstFlag = &cli.IntFlag{
+		Name:    "key-rate-burst",
+		Usage:   "Burst size of the per-key rate limit, which caps the size of batches when rate limited",
+		EnvVars: PrefixEnvVar("KEY_RATE_BURST"),
+		Value:   1,
+	}
+	KeyMaxConcurrentJobsFlag = &cli.IntFlag{
+		Name:    "key-max-concurrent-jobs",
+		Usage:   "Queued or running proofs allowed per API key or JWT subject (0 = unlimited)",
+		EnvVars: PrefixEnvVar("KEY_MAX_CONCURRENT_JOBS"),
+	}
+	IPRateLimitFlag = &cli.Float64Flag{
+		Name:    "ip-rate-limit",
+		Usage:   "Proofs per minute allowed per client IP (0 = unlimited)",
+		EnvVars: PrefixEnvVar("IP_RATE_LIMIT"),
+	}
+	IPRateBurstFlag = &cli.IntFlag{
+		Name:    "ip-rate-burst",
+		Usage:   "Burst size of the per-IP rate limit, which caps the size of batches when rate limited",
+		EnvVars: PrefixEnvVar("IP_RATE_BURST"),
+		Value:   1,
+	}
+	IPMaxConcurrentJobsFlag = &cli.IntFlag{
+		Name:    "ip-max-concurrent-jobs",
+		Usage:   "Queued or running proofs allowed per client IP (0 = unlimited)",
+		EnvVars: PrefixEnvVar("IP_MAX_CONCURRENT_JOBS"),
+	}
+	CORSAllowedOriginsFlag = &cli.StringSliceFlag{
+		Name:    "cors-allowed-origins",
+		Usage:   "Origins allowed to make cross-origin and WebSocket requests (* for any)",
+		EnvVars: PrefixEnvVar("CORS_ALLOWED_ORIGINS"),
+		Value:   cli.NewStringSlice("*"),
+	}
+	CORSAllowedMethodsFlag = &cli.StringSliceFlag{
+		Name:    "cors-allowed-methods",
+		Usage:   "Methods allowed in cross-origin requests",
+		EnvVars: PrefixEnvVar("CORS_ALLOWED_METHODS"),
+		Value:   cli.NewStringSlice("GET", "POST", "OPTIONS"),
+	}
+	CORSAllowedHeadersFlag = &cli.StringSliceFlag{
+		Name:    "cors-allowed-headers",
+		Usage:   "Headers allowed in cross-origin requests",
+		EnvVars: PrefixEnvVar("CORS_ALLOWED_HEADERS"),
+		Value:   cli.NewStringSlice("Origin", "X-Requested-With", "Content-Type", "Accept", "Authorization", "X-API-Key"),
+	}
+	MaxBodySizeFlag = &cli.IntFlag{
+		Name:    "max-body-size",
+		Usage:   "Maximum size in bytes of an HTTP request body or WebSocket message",
+		EnvVars: PrefixEnvVar("MAX_BODY_SIZE"),
+		Value:   1024 * 1024,
+	}
+	MaxSignatureSizeFlag = &cli.IntFlag{
+		Name:    "max-signature-size",
+		Usage:   "Maximum size in bytes of the signature parameter",
+		EnvVars: PrefixEnvVar("MAX_SIGNATURE_SIZE"),
+		Value:   4096,
+	}
+	MaxBatchRequestsFlag = &cli.IntFlag{
+		Name:    "max-batch-requests",
+		Usage:   "Maximum number of requests in a recover_proveSignatureBatch call, 0 for no limit",
+		EnvVars: PrefixEnvVar("MAX_BATCH_REQUESTS"),
+		Value:   256,
+	}
+	TLSCertFlag = &cli.StringFlag{
+		Name:    "tls-cert",
+		Usage:   "PEM certificate to serve HTTPS and WSS with; reloaded on change",
+		EnvVars: PrefixEnvVar("TLS_CERT"),
+	}
+	TLSKeyFlag = &cli.StringFlag{
+		Name:    "tls-key",
+		Usage:   "PEM private key for --tls-cert; reloaded on change",
+		EnvVars: PrefixEnvVar("TLS_KEY"),
+	}
+	TLSClientCAFlag = &cli.StringFlag{
+		Name:    "tls-client-ca",
+		Usage:   "PEM CA bundle used to verify client certificates; a verified certificate authenticates the caller",
+		EnvVars: PrefixEnvVar("TLS_CLIENT_CA"),
+	}
 )
 
 var Flags = []cli.Flag{
+	ConfigFlag,
 	PortFlag,
 	CircuitPathFlag,
+	CircuitShardsFlag,
+	CircuitFileModeFlag,
+	CircuitDirModeFlag,
+	CircuitMmapFlag,
+	CircuitBucketFlag,
+	CircuitURLFlag,
+	CircuitChecksumsFlag,
+	CircuitRequireChecksumFlag,
+	S3PartSizeFlag,
+	S3ConcurrencyFlag,
+	S3MaxRetriesFlag,
+	StorageKeyFlag,
+	StorageKeyFileFlag,
+	CircuitManifestFlag,
+	CircuitManifestKeyFlag,
+	VerificationFlag,
+	VerifyCircuitsFlag,
+	MaxConcurrentProofsFlag,
+	JobRetentionFlag,
+	APIKeysFlag,
+	JWTSecretFlag,
+	RealIPHeaderFlag,
+	RealIPHopsFlag,
+	KeyRateLimitFlag,
+	KeyRateBurstFlag,
+	KeyMaxConcurrentJobsFlag,
+	IPRateLimitFlag,
+	IPRateBurstFlag,
+	IPMaxConcurrentJobsFlag,
+	CORSAllowedOriginsFlag,
+	CORSAllowedMethodsFlag,
+	CORSAllowedHeadersFlag,
+	MaxBodySizeFlag,
+	MaxSignatureSizeFlag,
+	MaxBatchRequestsFlag,
+	TLSCertFlag,
+	TLSKeyFlag,
+	TLSClientCAFlag,
 }
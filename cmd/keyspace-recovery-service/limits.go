@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/base-org/keyspace-recovery-service/auth"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+// newLimiterConfig returns the per-key and per-IP limits. A batch is charged
+// one proof and one job per request, so batches larger than a burst or job
+// quota are always rejected. That is only a configuration error when the
+// operator set both --max-batch-requests and the burst or quota; otherwise
+// such batches are rejected when they are requested, as the defaults would
+// fail any configuration that merely enables a rate limit.
+func newLimiterConfig(cliCtx *cli.Context) (auth.LimiterConfig, error) {
+	cfg := auth.LimiterConfig{
+		Key: auth.Limit{
+			PerMinute:     cliCtx.Float64(KeyRateLimitFlag.Name),
+			Burst:         cliCtx.Int(KeyRateBurstFlag.Name),
+			MaxConcurrent: cliCtx.Int(KeyMaxConcurrentJobsFlag.Name),
+		},
+		IP: auth.Limit{
+			PerMinute:     cliCtx.Float64(IPRateLimitFlag.Name),
+			Burst:         cliCtx.Int(IPRateBurstFlag.Name),
+			MaxConcurrent: cliCtx.Int(IPMaxConcurrentJobsFlag.Name),
+		},
+	}
+	maxBatch := cliCtx.Int(MaxBatchRequestsFlag.Name)
+	if maxBatch <= 0 {
+		return cfg, nil
+	}
+	if cliCtx.IsSet(MaxBatchRequestsFlag.Name) {
+		explicit := auth.LimiterConfig{
+			Key: explicitLimit(cliCtx, cfg.Key, KeyRateBurstFlag, KeyMaxConcurrentJobsFlag),
+			IP:  explicitLimit(cliCtx, cfg.IP, IPRateBurstFlag, IPMaxConcurrentJobsFlag),
+		}
+		if err := explicit.CheckBatch(maxBatch); err != nil {
+			return cfg, fmt.Errorf("invalid limits, lower --%s or raise the burst and job quotas: %w", MaxBatchRequestsFlag.Name, err)
+		}
+	}
+	if err := cfg.CheckBatch(maxBatch); err != nil {
+		log.Warn("Large batches will be rejected by the limits", "maxBatchRequests", maxBatch, "error", err)
+	}
+	return cfg, nil
+}
+
+// explicitLimit keeps the parts of a limit whose burst or quota flag was set.
+func explicitLimit(cliCtx *cli.Context, l auth.Limit, burst, quota cli.Flag) auth.Limit {
+	if !cliCtx.IsSet(burst.Names()[0]) {
+		l.PerMinute = 0
+	}
+	if !cliCtx.IsSet(quota.Names()[0]) {
+		l.MaxConcurrent = 0
+	}
+	return l
+}
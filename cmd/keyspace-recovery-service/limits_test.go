@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/base-org/keyspace-recovery-service/auth"
+	"github.com/urfave/cli/v2"
+)
+
+// runLimiterConfig parses args with the service's flags and returns the
+// limiter configuration.
+func runLimiterConfig(t *testing.T, args ...string) (auth.LimiterConfig, error) {
+	t.Helper()
+	var cfg auth.LimiterConfig
+	var cfgErr error
+	app := cli.NewApp()
+	app.Flags = Flags
+	app.Action = func(cliCtx *cli.Context) error {
+		cfg, cfgErr = newLimiterConfig(cliCtx)
+		return nil
+	}
+	if err := app.Run(append([]string{"keyspace-recovery-service"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return cfg, cfgErr
+}
+
+func TestLimiterConfigDefaults(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"--ip-rate-limit", "10"},
+		{"--key-rate-limit", "10", "--ip-rate-limit", "10"},
+		{"--ip-max-concurrent-jobs", "4"},
+		{"--ip-rate-limit", "10", "--ip-rate-burst", "4"},
+		{"--ip-rate-limit", "10", "--max-batch-requests", "16"},
+	} {
+		cfg, err := runLimiterConfig(t, args...)
+		if err != nil {
+			t.Fatalf("%q: %v", args, err)
+		}
+		// Batches over the burst are still rejected when requested.
+		if cfg.IP.PerMinute > 0 {
+			_, err = auth.NewLimiter(cfg).AcquireN(auth.Identity{IP: "203.0.113.7"}, max(cfg.IP.Burst, 1)+1)
+			var limitErr *auth.LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("%q: batch over the burst: got %v", args, err)
+			}
+		}
+	}
+}
+
+func TestLimiterConfigExplicitMismatch(t *testing.T) {
+	for _, args := range [][]string{
+		{"--ip-rate-limit", "10", "--ip-rate-burst", "4", "--max-batch-requests", "16"},
+		{"--key-max-concurrent-jobs", "2", "--max-batch-requests", "16"},
+	} {
+		if _, err := runLimiterConfig(t, args...); err == nil {
+			t.Fatalf("%q: expected an error", args)
+		}
+	}
+	if _, err := runLimiterConfig(t, "--ip-rate-limit", "10", "--ip-rate-burst", "16", "--max-batch-requests", "16"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 
+	"github.com/base-org/keyspace-recovery-service/auth"
+	"github.com/base-org/keyspace-recovery-service/circuits"
 	"github.com/base-org/keyspace-recovery-service/proving"
 	"github.com/base-org/keyspace-recovery-service/proving/storage"
 	recover_rpc "github.com/base-org/keyspace-recovery-service/rpc"
@@ -30,6 +33,22 @@ func main() {
 	app.Name = "keyspace-recovery-service"
 	app.Description = "Keyspace Recovery Service"
 
+	app.Before = func(cliCtx *cli.Context) error {
+		if err := loadConfigFile(cliCtx); err != nil {
+			return err
+		}
+		if err := loadManifest(cliCtx); err != nil {
+			return err
+		}
+		return overrideVerification(cliCtx)
+	}
+	app.Commands = []*cli.Command{
+		ConfigCommand,
+		CircuitsCommand,
+		VkCommand,
+		ProofCommand,
+		ProveCommand,
+	}
 	app.Action = curryMain(Version)
 	err := app.Run(os.Args)
 	if err != nil {
@@ -43,26 +62,52 @@ func curryMain(version string) func(ctx *cli.Context) error {
 	}
 }
 
-func runServer(apis []rpc.API, portAddr string) (*http.Server, error) {
+type serverConfig struct {
+	addr        string
+	auth        *auth.Authenticator
+	cors        corsConfig
+	maxBodySize int
+	tls         *tlsReloader
+}
+
+func runServer(apis []rpc.API, cfg serverConfig) (*http.Server, error) {
 	handler := rpc.NewServer()
+	if cfg.maxBodySize > 0 {
+		handler.SetHTTPBodyLimit(cfg.maxBodySize)
+	}
 
 	if err := node.RegisterApis(apis, nil, handler); err != nil {
 		return nil, fmt.Errorf("error registering APIs: %w", err)
 	}
+	wsHandler := websocketHandler(handler, cfg.cors, int64(cfg.maxBodySize))
+
+	rpcHandler := cfg.auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			wsHandler.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
 
-	serv := &http.Server{Addr: portAddr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	serv := &http.Server{Addr: cfg.addr, Handler: corsHandler(cfg.cors, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet && r.URL.Path == "/_health" {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
-		handler.ServeHTTP(w, r)
-	})}
-	log.Info("Starting HTTP server", "address", portAddr)
+		rpcHandler.ServeHTTP(w, r)
+	}))}
+	if cfg.tls != nil {
+		serv.TLSConfig = cfg.tls.config()
+	}
+	log.Info("Starting HTTP and WebSocket server", "address", cfg.addr, "tls", cfg.tls != nil)
 	go func() {
-		err := serv.ListenAndServe()
+		var err error
+		if cfg.tls != nil {
+			// Certificates are served from TLSConfig.GetCertificate.
+			err = serv.ListenAndServeTLS("", "")
+		} else {
+			err = serv.ListenAndServe()
+		}
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Error("HTTP server failed", "error", err)
 		}
@@ -73,26 +118,143 @@ func runServer(apis []rpc.API, portAddr string) (*http.Server, error) {
 
 func Main(version string, cliCtx *cli.Context) error {
 	log.Info("Starting keyspace-recovery-service", "version", version)
-	path, err := filepath.Abs(cliCtx.String(CircuitPathFlag.Name))
+	if err := validateConfig(cliCtx); err != nil {
+		return err
+	}
+	s, err := newStorage(cliCtx)
 	if err != nil {
 		return err
 	}
-	log.Info("Using local storage", "path", path)
-	s := storage.NewFileStorage(path)
-	loader := proving.NewLockingCircuitLoader(s)
-	rpcService := recover_rpc.NewRecover(loader)
+	loader := proving.NewLockingCircuitLoader(s, cliCtx.Bool(VerifyCircuitsFlag.Name))
+	if err = loader.VerifyCircuits(circuits.All()); err != nil {
+		return err
+	}
+	jobs := recover_rpc.NewJobQueue(cliCtx.Int(MaxConcurrentProofsFlag.Name), cliCtx.Duration(JobRetentionFlag.Name))
+	var tlsReload *tlsReloader
+	if cliCtx.IsSet(TLSCertFlag.Name) || cliCtx.IsSet(TLSKeyFlag.Name) || cliCtx.IsSet(TLSClientCAFlag.Name) {
+		tlsReload, err = newTLSReloader(tlsFiles{
+			cert:     cliCtx.String(TLSCertFlag.Name),
+			key:      cliCtx.String(TLSKeyFlag.Name),
+			clientCA: cliCtx.String(TLSClientCAFlag.Name),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	authenticator := auth.NewAuthenticator(auth.Config{
+		APIKeys:        cliCtx.StringSlice(APIKeysFlag.Name),
+		JWTSecret:      cliCtx.String(JWTSecretFlag.Name),
+		ClientCertAuth: cliCtx.String(TLSClientCAFlag.Name) != "",
+		RealIPHeader:   cliCtx.String(RealIPHeaderFlag.Name),
+		RealIPHops:     cliCtx.Int(RealIPHopsFlag.Name),
+	})
+	log.Info("Configured authentication", "enabled", authenticator.Enabled())
+	limiterConfig, err := newLimiterConfig(cliCtx)
+	if err != nil {
+		return err
+	}
+	limiter := auth.NewLimiter(limiterConfig)
+	rpcService := recover_rpc.NewRecover(loader, jobs, authenticator, limiter, recover_rpc.RequestLimits{
+		MaxSignatureSize: cliCtx.Int(MaxSignatureSizeFlag.Name),
+		MaxBatchRequests: cliCtx.Int(MaxBatchRequestsFlag.Name),
+	})
 	recoveryAPI := rpc.API{
 		Namespace: "recover",
 		Service:   rpcService,
 	}
-	recoveryServer, err := runServer([]rpc.API{recoveryAPI}, fmt.Sprintf(":%d", cliCtx.Int(PortFlag.Name)))
+	recoveryServer, err := runServer([]rpc.API{recoveryAPI}, serverConfig{
+		addr: fmt.Sprintf(":%d", cliCtx.Int(PortFlag.Name)),
+		auth: authenticator,
+		cors: corsConfig{
+			allowedOrigins: cliCtx.StringSlice(CORSAllowedOriginsFlag.Name),
+			allowedMethods: upper(cliCtx.StringSlice(CORSAllowedMethodsFlag.Name)),
+			allowedHeaders: cliCtx.StringSlice(CORSAllowedHeadersFlag.Name),
+		},
+		maxBodySize: cliCtx.Int(MaxBodySizeFlag.Name),
+		tls:         tlsReload,
+	})
 	if err != nil {
 		return err
 	}
 
+	reloadChannel := make(chan os.Signal, 1)
+	signal.Notify(reloadChannel, syscall.SIGHUP)
 	interruptChannel := make(chan os.Signal, 1)
 	signal.Notify(interruptChannel, os.Interrupt, os.Kill, syscall.SIGTERM, syscall.SIGQUIT)
-	<-interruptChannel
+	for {
+		select {
+		case <-reloadChannel:
+			// Keep serving with the previous manifest if the new one is invalid.
+			if err := loadManifest(cliCtx); err != nil {
+				log.Error("Failed to reload circuit manifest", "error", err)
+			}
+		case <-interruptChannel:
+			return recoveryServer.Shutdown(context.Background())
+		}
+	}
+}
+
+// newStorage returns the circuit storage, encrypted if a storage key is
+// configured.
+func newStorage(cliCtx *cli.Context) (storage.Storage, error) {
+	store, err := newBaseStorage(cliCtx)
+	if err != nil {
+		return nil, err
+	}
+	var key []byte
+	if v := cliCtx.String(StorageKeyFlag.Name); v != "" {
+		key, err = storage.ParseKey(v)
+	} else if path := cliCtx.String(StorageKeyFileFlag.Name); path != "" {
+		key, err = storage.ReadKeyFile(path)
+	}
+	if err != nil || key == nil {
+		return store, err
+	}
+	log.Info("Encrypting circuit storage")
+	return storage.NewEncryptedStorage(store, key)
+}
 
-	return recoveryServer.Shutdown(context.Background())
+func newBaseStorage(cliCtx *cli.Context) (storage.Storage, error) {
+	if bucket := cliCtx.String(CircuitBucketFlag.Name); bucket != "" {
+		log.Info("Using S3 storage", "bucket", bucket)
+		return storage.NewS3Storage(bucket, storage.S3DownloadConfig{
+			PartSize:    cliCtx.Int64(S3PartSizeFlag.Name),
+			Concurrency: cliCtx.Int(S3ConcurrencyFlag.Name),
+			MaxRetries:  cliCtx.Int(S3MaxRetriesFlag.Name),
+		})
+	}
+	if baseURL := cliCtx.String(CircuitURLFlag.Name); baseURL != "" {
+		log.Info("Using HTTP storage", "url", baseURL)
+		return storage.NewHTTPStorage(baseURL, storage.HTTPConfig{
+			ChecksumFile:    cliCtx.String(CircuitChecksumsFlag.Name),
+			RequireChecksum: cliCtx.Bool(CircuitRequireChecksumFlag.Name),
+		})
+	}
+	path, err := filepath.Abs(cliCtx.String(CircuitPathFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	fileMode, err := parseMode(cliCtx.String(CircuitFileModeFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	dirMode, err := parseMode(cliCtx.String(CircuitDirModeFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Using local storage", "path", path)
+	return storage.NewFileStorage(path, storage.FileConfig{
+		Shards:   cliCtx.Int(CircuitShardsFlag.Name),
+		FileMode: fileMode,
+		DirMode:  dirMode,
+		Mmap:     cliCtx.Bool(CircuitMmapFlag.Name),
+	}), nil
+}
+
+func upper(values []string) []string {
+	upper := make([]string, len(values))
+	for i, v := range values {
+		upper[i] = strings.ToUpper(strings.TrimSpace(v))
+	}
+	return upper
 }
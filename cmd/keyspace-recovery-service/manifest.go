@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+var ManifestFormatFlag = &cli.StringFlag{
+	Name:  "format",
+	Usage: "Output format, json or toml",
+	Value: "json",
+}
+
+// loadManifest applies the circuit manifest configured with
+// --circuit-manifest or --circuit-manifest-key, if any.
+func loadManifest(cliCtx *cli.Context) error {
+	path := cliCtx.String(CircuitManifestFlag.Name)
+	key := cliCtx.String(CircuitManifestKeyFlag.Name)
+	var data []byte
+	var err error
+	switch {
+	case path != "" && key != "":
+		return fmt.Errorf("--%s and --%s are mutually exclusive", CircuitManifestFlag.Name, CircuitManifestKeyFlag.Name)
+	case path != "":
+		data, err = os.ReadFile(path)
+	case key != "":
+		path = key
+		data, err = readStorageKey(cliCtx, key)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read circuit manifest: %w", err)
+	}
+	m, err := circuits.ParseManifest(data, filepath.Ext(path))
+	if err != nil {
+		return err
+	}
+	if err = circuits.ApplyManifest(m); err != nil {
+		return err
+	}
+	log.Info("Loaded circuit manifest", "source", path, "circuits", len(m.Circuits))
+	return nil
+}
+
+// overrideVerification applies the policies given with --verification, which
+// take precedence over the manifest and survive reloading it.
+func overrideVerification(cliCtx *cli.Context) error {
+	overrides, err := circuits.ParseVerificationOverrides(cliCtx.StringSlice(VerificationFlag.Name))
+	if err != nil {
+		return fmt.Errorf("invalid --%s: %w", VerificationFlag.Name, err)
+	}
+	for id := range overrides {
+		if id == "" {
+			continue
+		}
+		if _, err = circuits.ById(id); err != nil {
+			return fmt.Errorf("invalid --%s: %w", VerificationFlag.Name, err)
+		}
+	}
+	circuits.OverrideVerification(overrides)
+	return nil
+}
+
+func readStorageKey(cliCtx *cli.Context, key string) ([]byte, error) {
+	store, err := newStorage(cliCtx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := store.Reader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// printManifest prints the circuits currently known to the service as a
+// manifest, as a starting point for --circuit-manifest.
+func printManifest(cliCtx *cli.Context) error {
+	m := circuits.ManifestOf(circuits.All())
+	var buf bytes.Buffer
+	switch format := cliCtx.String(ManifestFormatFlag.Name); format {
+	case "json":
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	case "toml":
+		if err := toml.NewEncoder(&buf).Encode(m); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported format %q, expected json or toml", format)
+	}
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
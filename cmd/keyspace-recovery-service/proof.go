@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/base-org/keyspace-recovery-service/signatures"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	ProofFileFlag = &cli.StringFlag{
+		Name:     "proof",
+		Usage:    "File containing the proof in the onchain serialization of the circuit's curve, hex or binary",
+		Required: true,
+	}
+	VkFileFlag = &cli.StringFlag{
+		Name:  "vk",
+		Usage: "File containing the verifying key in the onchain serialization of the circuit's curve, hex or binary; defaults to the circuit's vk in storage",
+	}
+	CircuitVersionFlag = &cli.StringFlag{
+		Name:  "circuit-version",
+		Usage: "Circuit version to use, see `circuits list`; defaults to the latest",
+	}
+	BatchSizeFlag = &cli.IntFlag{
+		Name:  "batch-size",
+		Usage: "Number of transactions, selecting the compiled variant of MultiTx circuits",
+		Value: 1,
+	}
+	PublicInputsFileFlag = &cli.StringFlag{
+		Name:     "public-inputs",
+		Usage:    "JSON file containing an array of public inputs as decimal or 0x-prefixed hex strings",
+		Required: true,
+	}
+)
+
+var ProofCommand = &cli.Command{
+	Name:  "proof",
+	Usage: "Work with account proofs",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "verify",
+			Usage:     "Verify a serialized proof against a verifying key and public inputs",
+			ArgsUsage: "<id>",
+			Flags:     []cli.Flag{ProofFileFlag, VkFileFlag, PublicInputsFileFlag, CircuitVersionFlag, BatchSizeFlag},
+			Action:    verifyProof,
+		},
+	},
+}
+
+func verifyProof(cliCtx *cli.Context) error {
+	cm, err := circuitArg(cliCtx)
+	if err != nil {
+		return err
+	}
+
+	proofBytes, err := readBytesFile(cliCtx.String(ProofFileFlag.Name))
+	if err != nil {
+		return err
+	}
+	proof, err := signatures.ReadProof(cm, proofBytes)
+	if err != nil {
+		return err
+	}
+
+	var vk plonk.VerifyingKey
+	if path := cliCtx.String(VkFileFlag.Name); path != "" {
+		vkBytes, err := readBytesFile(path)
+		if err != nil {
+			return err
+		}
+		if vk, err = signatures.ReadVk(cm, vkBytes); err != nil {
+			return err
+		}
+	} else {
+		store, err := newStorage(cliCtx)
+		if err != nil {
+			return err
+		}
+		version, err := cm.Select(circuits.Selection{Version: cliCtx.String(CircuitVersionFlag.Name)})
+		if err != nil {
+			return err
+		}
+		filename, err := cm.Filename(version, cliCtx.Int(BatchSizeFlag.Name))
+		if err != nil {
+			return err
+		}
+		if _, _, vk, err = proving.Load(store, filename, cm.Field, true, nil); err != nil {
+			return err
+		}
+	}
+
+	inputs, err := readPublicInputs(cliCtx.String(PublicInputsFileFlag.Name))
+	if err != nil {
+		return err
+	}
+	if len(inputs) != vk.NbPublicWitness() {
+		return fmt.Errorf("expected %d public inputs, got %d", vk.NbPublicWitness(), len(inputs))
+	}
+	w, err := witness.New(cm.Field)
+	if err != nil {
+		return err
+	}
+	values := make(chan any, len(inputs))
+	for _, v := range inputs {
+		values <- v
+	}
+	close(values)
+	if err = w.Fill(len(inputs), 0, values); err != nil {
+		return err
+	}
+
+	if err = proving.Verify(proof, vk, w, cm.Field, cm.Outer); err != nil {
+		return fmt.Errorf("proof verification failed: %w", err)
+	}
+	fmt.Println("proof is valid")
+	return nil
+}
+
+// readBytesFile reads a file containing either hex, with or without a 0x
+// prefix, or raw bytes.
+func readBytesFile(path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := strings.TrimPrefix(strings.TrimSpace(string(contents)), "0x")
+	if b, err := hex.DecodeString(trimmed); err == nil {
+		return b, nil
+	}
+	return contents, nil
+}
+
+func readPublicInputs(path string) ([]*big.Int, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	if err = json.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("unable to parse public inputs: %w", err)
+	}
+	inputs := make([]*big.Int, len(raw))
+	for i, r := range raw {
+		s := strings.Trim(string(r), `"`)
+		v, ok := new(big.Int).SetString(s, 0)
+		if !ok {
+			return nil, errors.New("invalid public input " + s)
+		}
+		inputs[i] = v
+	}
+	return inputs, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
+	recover_rpc "github.com/base-org/keyspace-recovery-service/rpc"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	SignatureTypeFlag = &cli.StringFlag{
+		Name:     "type",
+		Usage:    "Signature type, one of the recover_proveSignature types (secp256k1 or webauthn)",
+		Required: true,
+	}
+	KeyFlag = &cli.StringFlag{
+		Name:     "key",
+		Usage:    "Current Keyspace key as 0x-prefixed hex",
+		Required: true,
+	}
+	NewKeyFlag = &cli.StringFlag{
+		Name:     "new-key",
+		Usage:    "New Keyspace key as 0x-prefixed hex",
+		Required: true,
+	}
+	SignatureFlag = &cli.StringFlag{
+		Name:     "signature",
+		Usage:    "Signature over the new key as 0x-prefixed hex",
+		Required: true,
+	}
+	VkHashFlag = &cli.StringFlag{
+		Name:  "vk-hash",
+		Usage: "Select the circuit version by the vk hash the key was created with, instead of --circuit-version",
+	}
+	OutputFlag = &cli.StringFlag{
+		Name:  "output",
+		Usage: "File to write the ProveSignatureResponse JSON to; defaults to stdout",
+	}
+	WitnessOutputFlag = &cli.StringFlag{
+		Name:  "witness-output",
+		Usage: "File to write the binary gnark witness to for later replay",
+	}
+	DryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Only validate the request and solve the circuit, without loading the proving key or proving",
+	}
+)
+
+var ProveCommand = &cli.Command{
+	Name:  "prove",
+	Usage: "Generate a single recovery proof without starting the RPC server",
+	Flags: []cli.Flag{
+		SignatureTypeFlag,
+		KeyFlag,
+		NewKeyFlag,
+		SignatureFlag,
+		CircuitVersionFlag,
+		VkHashFlag,
+		BatchSizeFlag,
+		OutputFlag,
+		WitnessOutputFlag,
+		DryRunFlag,
+	},
+	Action: prove,
+}
+
+func prove(cliCtx *cli.Context) error {
+	signatureType := cliCtx.String(SignatureTypeFlag.Name)
+	if _, ok := recover_rpc.ProveSignatureHandlers[signatureType]; !ok {
+		types := make([]string, 0, len(recover_rpc.ProveSignatureHandlers))
+		for t := range recover_rpc.ProveSignatureHandlers {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		return fmt.Errorf("unsupported signature type %q, expected one of %v", signatureType, types)
+	}
+	key, err := hexutil.DecodeBig(cliCtx.String(KeyFlag.Name))
+	if err != nil {
+		return fmt.Errorf("invalid --%s: %w", KeyFlag.Name, err)
+	}
+	newKey, err := hexutil.DecodeBig(cliCtx.String(NewKeyFlag.Name))
+	if err != nil {
+		return fmt.Errorf("invalid --%s: %w", NewKeyFlag.Name, err)
+	}
+	signature, err := hexutil.Decode(cliCtx.String(SignatureFlag.Name))
+	if err != nil {
+		return fmt.Errorf("invalid --%s: %w", SignatureFlag.Name, err)
+	}
+
+	store, err := newStorage(cliCtx)
+	if err != nil {
+		return err
+	}
+	loader := proving.NewLockingCircuitLoader(store, cliCtx.Bool(VerifyCircuitsFlag.Name))
+	reporter := &cliReporter{witnessPath: cliCtx.String(WitnessOutputFlag.Name)}
+	sel := circuits.Selection{
+		Version: cliCtx.String(CircuitVersionFlag.Name),
+		VkHash:  cliCtx.String(VkHashFlag.Name),
+		TxCount: cliCtx.Int(BatchSizeFlag.Name),
+	}
+	response, err := recover_rpc.ProveSignatureWith(loader, reporter, key, newKey, signature, signatureType, sel, cliCtx.Bool(DryRunFlag.Name))
+	if err != nil {
+		return err
+	}
+	if reporter.err != nil {
+		return reporter.err
+	}
+
+	out, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+	if path := cliCtx.String(OutputFlag.Name); path != "" {
+		return os.WriteFile(path, out, 0o644)
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// cliReporter logs progress and optionally saves the witness.
+type cliReporter struct {
+	witnessPath string
+	percent     int64
+	err         error
+}
+
+func (r *cliReporter) ReportStage(stage proving.Stage) {
+	log.Info("Proof stage", "stage", stage)
+}
+
+func (r *cliReporter) ReportLoading(p storage.Progress) {
+	if p.Total <= 0 {
+		return
+	}
+	if percent := p.Percent(); percent/10 != r.percent/10 {
+		log.Info("Loading circuit", "key", p.Key, "percent", percent, "eta", p.ETA().Round(time.Second))
+		r.percent = percent
+	}
+}
+
+func (r *cliReporter) ReportWitness(circuitId string, wit []byte) {
+	if r.witnessPath == "" {
+		return
+	}
+	if err := os.WriteFile(r.witnessPath, wit, 0o600); err != nil {
+		r.err = fmt.Errorf("unable to write witness: %w", err)
+		return
+	}
+	log.Info("Wrote witness", "circuit", circuitId, "path", r.witnessPath)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/base-org/keyspace-recovery-service/signatures"
+	pbn254 "github.com/consensys/gnark/backend/plonk/bn254"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli/v2"
+)
+
+var VkCommand = &cli.Command{
+	Name:  "vk",
+	Usage: "Work with circuit verifying keys",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "export",
+			Usage:     "Print a circuit's verifying key serialization, as returned in currentVk, and its keccak256 hash",
+			ArgsUsage: "<id>",
+			Action:    exportVk,
+		},
+		{
+			Name:      "solidity",
+			Usage:     "Print the Solidity verifier contract of each version of a circuit with Solidity support",
+			ArgsUsage: "<id>",
+			Action:    exportSolidity,
+		},
+	},
+}
+
+func exportVk(cliCtx *cli.Context) error {
+	cm, err := circuitArg(cliCtx)
+	if err != nil {
+		return err
+	}
+	store, err := newStorage(cliCtx)
+	if err != nil {
+		return err
+	}
+	for _, v := range cm.Versions {
+		for _, filename := range v.Filenames {
+			_, _, vk, err := proving.Load(store, filename, cm.Field, true, nil)
+			if err != nil {
+				return fmt.Errorf("unable to load %s: %w", filename, err)
+			}
+			b, err := signatures.VkBytes(cm, vk)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("version:  %s\n", v.Name)
+			fmt.Printf("filename: %s\n", filename)
+			fmt.Printf("vk:       %s\n", hexutil.Encode(b))
+			fmt.Printf("hash:     %s\n", signatures.VkHash(b))
+		}
+	}
+	return nil
+}
+
+func exportSolidity(cliCtx *cli.Context) error {
+	cm, err := circuitArg(cliCtx)
+	if err != nil {
+		return err
+	}
+	if !cm.Solidity {
+		return fmt.Errorf("circuit %s has no Solidity verifier", cm.Id)
+	}
+	store, err := newStorage(cliCtx)
+	if err != nil {
+		return err
+	}
+	for _, v := range cm.Versions {
+		for _, filename := range v.Filenames {
+			_, _, vk, err := proving.Load(store, filename, cm.Field, true, nil)
+			if err != nil {
+				return fmt.Errorf("unable to load %s: %w", filename, err)
+			}
+			bn254vk, ok := vk.(*pbn254.VerifyingKey)
+			if !ok {
+				return errors.New("Solidity export only supports BN254 circuits")
+			}
+			fmt.Printf("// version:  %s\n", v.Name)
+			fmt.Printf("// filename: %s\n", filename)
+			if err = bn254vk.ExportSolidity(os.Stdout); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
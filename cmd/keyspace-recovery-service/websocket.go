@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 30 * time.Second
+	wsWriteTimeout = 10 * time.Second
+)
+
+// websocketHandler serves JSON-RPC over WebSocket like rpc.Server's own
+// handler, but limits messages to maxMessageSize rather than geth's fixed
+// 32 MiB, so --max-body-size bounds both transports. Requests without an
+// Origin header are not from a browser and are always accepted.
+func websocketHandler(server *rpc.Server, cors corsConfig, maxMessageSize int64) http.Handler {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || cors.originAllowed(origin)
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Debug("WebSocket upgrade failed", "error", err)
+			return
+		}
+		if maxMessageSize > 0 {
+			conn.SetReadLimit(maxMessageSize)
+		}
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Time{})
+		})
+		ws := &wsConn{conn: conn, closed: make(chan struct{})}
+		go ws.ping()
+		server.ServeCodec(rpc.NewFuncCodec(ws, ws.writeJSON, conn.ReadJSON), 0)
+	})
+}
+
+// wsConn adapts a WebSocket connection to rpc.NewFuncCodec and keeps it alive
+// with pings.
+type wsConn struct {
+	conn      *websocket.Conn
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (c *wsConn) writeJSON(v interface{}, _ bool) error {
+	return c.conn.WriteJSON(v)
+}
+
+// RemoteAddr is the address of the peer, which auth.Authenticator resolves
+// the identity of WebSocket calls from.
+func (c *wsConn) RemoteAddr() string {
+	return c.conn.RemoteAddr().String()
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.conn.Close()
+}
+
+// ping sends a ping every wsPingInterval, closing the connection if the peer
+// does not answer within wsPongTimeout.
+func (c *wsConn) ping() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// The deadline is set first, so a fast pong cannot be overtaken.
+			_ = c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				_ = c.Close()
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package proving
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/consensys/gnark"
+	"github.com/consensys/gnark/constraint"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const gnarkModule = "github.com/consensys/gnark"
+
+var (
+	ErrFingerprintMismatch = errors.New("circuit fingerprint mismatch")
+	// ErrNoFingerprint is returned when verifying a circuit file without a
+	// recorded fingerprint.
+	ErrNoFingerprint = errors.New("no circuit fingerprint recorded")
+)
+
+// GnarkVersion returns the version of the gnark module the binary was built
+// with, falling back to gnark's own version string when build information is
+// unavailable.
+func GnarkVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path != gnarkModule {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			return dep.Version
+		}
+	}
+	return "v" + gnark.Version.String()
+}
+
+// Fingerprint returns a deterministic keccak256 hash over the gnark version and
+// the serialized constraint system. It is identical whether the constraint
+// system was just compiled or read back from stored artifacts.
+func Fingerprint(ccs constraint.ConstraintSystem) (string, error) {
+	h := crypto.NewKeccakState()
+	fmt.Fprintf(h, "gnark@%s\n", GnarkVersion())
+	if _, err := ccs.WriteTo(h); err != nil {
+		return "", err
+	}
+	return hexutil.Encode(h.Sum(nil)), nil
+}
+
+// VerifyFingerprint checks a loaded constraint system against the fingerprint
+// recorded in the circuit metadata for filename. Files without a recorded
+// fingerprint are rejected, as they cannot be verified.
+func VerifyFingerprint(filename string, ccs constraint.ConstraintSystem) error {
+	expected, ok := circuits.FingerprintOf(filename)
+	if !ok {
+		return fmt.Errorf("%w for %s", ErrNoFingerprint, filename)
+	}
+	actual, err := Fingerprint(ccs)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("%w: %s has %s, expected %s", ErrFingerprintMismatch, filename, actual, expected)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package proving
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -20,67 +21,160 @@ import (
 	cbw6761 "github.com/consensys/gnark/constraint/bw6-761"
 )
 
-func Load(store storage.Storage, filename string, field *big.Int, onlyVk bool) (constraint.ConstraintSystem, plonk.ProvingKey, plonk.VerifyingKey, error) {
-	var vk plonk.VerifyingKey
-	var pk plonk.ProvingKey
-	var ccs constraint.ConstraintSystem
+type part struct {
+	suffix     string
+	readerFrom io.ReaderFrom
+	buffer     bool
+}
 
-	if field.Cmp(ecc.BLS12_377.ScalarField()) == 0 {
-		vk = &pbls12377.VerifyingKey{}
-		pk = &pbls12377.ProvingKey{}
-		ccs = &cbls12377.SparseR1CS{}
-	} else if field.Cmp(ecc.BN254.ScalarField()) == 0 {
-		vk = &pbn254.VerifyingKey{}
-		pk = &pbn254.ProvingKey{}
-		ccs = &cbn254.SparseR1CS{}
-	} else if field.Cmp(ecc.BW6_761.ScalarField()) == 0 {
-		vk = &pbw6761.VerifyingKey{}
-		pk = &pbw6761.ProvingKey{}
-		ccs = &cbw6761.SparseR1CS{}
-	} else {
-		return nil, nil, nil, fmt.Errorf("unsupported field")
+func Load(store storage.Storage, filename string, field *big.Int, onlyVk bool, reporter Reporter) (constraint.ConstraintSystem, plonk.ProvingKey, plonk.VerifyingKey, error) {
+	ccs, pk, vk, err := emptyCircuit(field)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	types := []struct {
-		suffix     string
-		readerFrom io.ReaderFrom
-		buffer     bool
-	}{
+	parts := []part{
 		{"vk", vk, false},
 		{"pk", pk, false},
 		{"ccs", ccs, true},
 	}
 	if onlyVk {
-		types = types[:1]
+		parts = parts[:1]
+	}
+	if err = loadParts(store, filename, parts, reporter); err != nil {
+		return nil, nil, nil, err
+	}
+	return ccs, pk, vk, nil
+}
+
+// LoadWithoutPk loads the constraint system and verifying key of a circuit,
+// skipping the proving key which is only needed to generate proofs.
+func LoadWithoutPk(store storage.Storage, filename string, field *big.Int, reporter Reporter) (constraint.ConstraintSystem, plonk.VerifyingKey, error) {
+	ccs, _, vk, err := emptyCircuit(field)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = loadParts(store, filename, []part{{"vk", vk, false}, {"ccs", ccs, true}}, reporter); err != nil {
+		return nil, nil, err
+	}
+	return ccs, vk, nil
+}
+
+// LoadPk loads the proving key of a circuit, completing a circuit loaded with
+// LoadWithoutPk.
+func LoadPk(store storage.Storage, filename string, field *big.Int, reporter Reporter) (plonk.ProvingKey, error) {
+	_, pk, _, err := emptyCircuit(field)
+	if err != nil {
+		return nil, err
+	}
+	if err = loadParts(store, filename, []part{{"pk", pk, false}}, reporter); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+func emptyCircuit(field *big.Int) (constraint.ConstraintSystem, plonk.ProvingKey, plonk.VerifyingKey, error) {
+	if field.Cmp(ecc.BLS12_377.ScalarField()) == 0 {
+		return &cbls12377.SparseR1CS{}, &pbls12377.ProvingKey{}, &pbls12377.VerifyingKey{}, nil
+	} else if field.Cmp(ecc.BN254.ScalarField()) == 0 {
+		return &cbn254.SparseR1CS{}, &pbn254.ProvingKey{}, &pbn254.VerifyingKey{}, nil
+	} else if field.Cmp(ecc.BW6_761.ScalarField()) == 0 {
+		return &cbw6761.SparseR1CS{}, &pbw6761.ProvingKey{}, &pbw6761.VerifyingKey{}, nil
 	}
+	return nil, nil, nil, fmt.Errorf("unsupported field")
+}
 
-	for _, t := range types {
+func loadParts(store storage.Storage, filename string, parts []part, reporter Reporter) error {
+	reporter = orNop(reporter)
+	for _, t := range parts {
 		log.Info(fmt.Sprintf("Retrieving circuit %s", t.suffix), "filename", filename)
 		key := fmt.Sprintf("%s.%s", filename, t.suffix)
-		reader, err := store.Reader(key)
+		if mapper, ok := store.(storage.Mapper); ok {
+			mapping, err := mapper.Map(key)
+			if err == nil {
+				err = loadMapped(mapping, key, t, reporter)
+				if err != nil {
+					return err
+				}
+				continue
+			} else if !errors.Is(err, storage.ErrMmapUnsupported) && !errors.Is(err, storage.ErrNotExist) {
+				return err
+			}
+		}
+		reader, codec, err := openPart(store, key)
 		if err != nil {
-			return nil, nil, nil, err
+			return err
+		}
+		stored := key
+		if codec != nil {
+			stored += codec.Ext
+		}
+		reader = storage.NewProgressReader(reader, loadTracker(stored, storage.ReaderSize(reader), reporter))
+		if codec != nil {
+			if reader, err = storage.NewDecompressingReader(reader, *codec); err != nil {
+				return err
+			}
 		}
 		if t.buffer {
 			contents, err := io.ReadAll(reader)
 			if err != nil {
-				return nil, nil, nil, err
+				return err
 			}
 			err = reader.Close()
 			if err != nil {
-				return nil, nil, nil, err
+				return err
 			}
 			reader = io.NopCloser(bytes.NewBuffer(contents))
 		}
 		_, err = t.readerFrom.ReadFrom(reader)
 		if err != nil {
-			return nil, nil, nil, err
+			return err
 		}
 		err = reader.Close()
 		if err != nil {
-			return nil, nil, nil, err
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTracker tracks loading a part for the reporter and the logs.
+func loadTracker(key string, size int64, reporter Reporter) *storage.ProgressTracker {
+	return storage.NewProgressTracker(key, size).
+		Subscribe(0, reporter.ReportLoading).
+		Subscribe(storage.DefaultLogInterval, storage.LogProgress("Loading circuit"))
+}
+
+// openPart opens the object stored under key or, if there is none, under key
+// with the extension of one of storage.Codecs, returning the codec it is
+// compressed with.
+func openPart(store storage.Storage, key string) (io.ReadCloser, *storage.Codec, error) {
+	reader, err := store.Reader(key)
+	if !errors.Is(err, storage.ErrNotExist) {
+		return reader, nil, err
+	}
+	for _, codec := range storage.Codecs {
+		compressed, cerr := store.Reader(key + codec.Ext)
+		if cerr == nil {
+			log.Info("Decompressing circuit", "key", key+codec.Ext, "compression", codec.Name)
+			return compressed, &codec, nil
+		} else if !errors.Is(cerr, storage.ErrNotExist) {
+			return nil, nil, cerr
 		}
 	}
+	return nil, nil, err
+}
 
-	return ccs, pk, vk, nil
+// loadMapped deserializes a part from a memory-mapped object, with the same
+// checks as a streamed one. The mapping is already in memory, so unlike a
+// streamed constraint system it is not buffered first.
+func loadMapped(mapping *storage.Mapping, key string, t part, reporter Reporter) error {
+	data := mapping.Bytes()
+	reader := storage.NewProgressReader(io.NopCloser(bytes.NewReader(data)), loadTracker(key, int64(len(data)), reporter))
+	_, err := t.readerFrom.ReadFrom(reader)
+	// Deserializing copies everything out of the mapping.
+	if cerr := mapping.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
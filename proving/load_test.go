@@ -0,0 +1,67 @@
+package proving
+
+import (
+	"testing"
+
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+)
+
+// benchCircuit is large enough for loading its keys to dominate the overhead
+// of the benchmark.
+type benchCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *benchCircuit) Define(api frontend.API) error {
+	x := c.X
+	for i := 0; i < 1<<14; i++ {
+		x = api.Add(api.Mul(x, x), i)
+	}
+	api.AssertIsDifferent(x, c.Y)
+	return nil
+}
+
+// storeBenchCircuit compiles and sets up benchCircuit into a file storage
+// directory, returning it with the filename of the circuit.
+func storeBenchCircuit(b *testing.B) (string, string) {
+	b.Helper()
+	ccs, err := Compile(&benchCircuit{}, ecc.BN254.ScalarField())
+	if err != nil {
+		b.Fatal(err)
+	}
+	c, err := Setup(ccs, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir := b.TempDir()
+	if err = Store(storage.NewFileStorage(dir, storage.FileConfig{}), "bench", c); err != nil {
+		b.Fatal(err)
+	}
+	return dir, "bench"
+}
+
+func benchmarkLoad(b *testing.B, mmap bool) {
+	dir, filename := storeBenchCircuit(b)
+	store := storage.NewFileStorage(dir, storage.FileConfig{Mmap: mmap})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := Load(store, filename, ecc.BN254.ScalarField(), false, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoadReadFrom loads a circuit by streaming its files into the heap.
+func BenchmarkLoadReadFrom(b *testing.B) {
+	benchmarkLoad(b, false)
+}
+
+// BenchmarkLoadMmap loads the same circuit from memory-mapped files, with the
+// same checks.
+func BenchmarkLoadMmap(b *testing.B) {
+	benchmarkLoad(b, true)
+}
@@ -2,31 +2,48 @@ package proving
 
 import (
 	"bytes"
+	"fmt"
 	"math/big"
 	"sync"
 
+	"github.com/base-org/keyspace-recovery-service/circuits"
 	"github.com/base-org/keyspace-recovery-service/proving/storage"
 	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
 	"github.com/ethereum/go-ethereum/log"
 )
 
 type LockingCircuitLoader struct {
-	store  storage.Storage
-	loaded map[string]*CompiledCircuit
-	lock   sync.Mutex
-	locks  map[string]*sync.Mutex
+	store storage.Storage
+	// verify checks loaded constraint systems against their recorded
+	// fingerprint. verified holds the files already checked, so they are not
+	// checked again.
+	verify   bool
+	verified map[string]struct{}
+	loaded   map[string]*CompiledCircuit
+	// partial holds circuits loaded without their proving key, until it is
+	// needed.
+	partial   map[string]*CompiledCircuit
+	lock      sync.Mutex
+	locks     map[string]*sync.Mutex
+	reporters map[string]map[Reporter]struct{}
 }
 
 var _ CircuitLoader = (*LockingCircuitLoader)(nil)
 
 /**
  * Creates a new CircuitStorageManager to manage loading compiled circuits asychronously.
+ * With verifyFingerprints, circuits are checked against their recorded fingerprint as they are loaded.
  */
-func NewLockingCircuitLoader(store storage.Storage) *LockingCircuitLoader {
+func NewLockingCircuitLoader(store storage.Storage, verifyFingerprints bool) *LockingCircuitLoader {
 	return &LockingCircuitLoader{
-		store:  store,
-		loaded: make(map[string]*CompiledCircuit),
-		locks:  make(map[string]*sync.Mutex),
+		store:     store,
+		verify:    verifyFingerprints,
+		verified:  make(map[string]struct{}),
+		loaded:    make(map[string]*CompiledCircuit),
+		partial:   make(map[string]*CompiledCircuit),
+		locks:     make(map[string]*sync.Mutex),
+		reporters: make(map[string]map[Reporter]struct{}),
 	}
 }
 
@@ -34,7 +51,7 @@ func (p *LockingCircuitLoader) Store() storage.Storage {
 	return p.store
 }
 
-func (p *LockingCircuitLoader) LoadAndProve(filename string, field, outer *big.Int, wit []byte, result chan ProveResult) {
+func (p *LockingCircuitLoader) LoadAndProve(filename string, field, outer *big.Int, wit []byte, reporter Reporter, result chan ProveResult) {
 	go func() {
 		w, err := witness.New(field)
 		if err != nil {
@@ -47,14 +64,14 @@ func (p *LockingCircuitLoader) LoadAndProve(filename string, field, outer *big.I
 		}
 
 		log.Info("Loading circuit", "filename", filename)
-		compiled, err := p.load(filename, field)
+		compiled, err := p.load(filename, field, reporter)
 		if err != nil {
 			result <- ProveResult{Err: err}
 			return
 		}
 
 		log.Info("Generating proof", "filename", filename)
-		pr, err := Prove(compiled, w, field, outer)
+		pr, err := Prove(compiled, w, field, outer, reporter)
 		if err != nil {
 			result <- ProveResult{Err: err}
 			return
@@ -70,9 +87,9 @@ func (p *LockingCircuitLoader) LoadAndProve(filename string, field, outer *big.I
 	}()
 }
 
-func (p *LockingCircuitLoader) Load(filename string, field *big.Int, result chan LoadCircuitResult) {
+func (p *LockingCircuitLoader) Load(filename string, field *big.Int, reporter Reporter, result chan LoadCircuitResult) {
 	go func() {
-		compiled, err := p.load(filename, field)
+		compiled, err := p.load(filename, field, reporter)
 		if err != nil {
 			result <- LoadCircuitResult{Err: err}
 			return
@@ -85,28 +102,181 @@ func (p *LockingCircuitLoader) Load(filename string, field *big.Int, result chan
 	}()
 }
 
-func (p *LockingCircuitLoader) load(filename string, field *big.Int) (*CompiledCircuit, error) {
+func (p *LockingCircuitLoader) LoadWithoutPk(filename string, field *big.Int, reporter Reporter, result chan LoadCircuitResult) {
+	go func() {
+		compiled, err := p.loadWithoutPk(filename, field, reporter)
+		if err != nil {
+			result <- LoadCircuitResult{Err: err}
+			return
+		}
+		result <- LoadCircuitResult{Circuit: &CompiledCircuit{
+			Ccs: compiled.Ccs,
+			Pk:  compiled.Pk,
+			Vk:  compiled.Vk,
+		}}
+	}()
+}
+
+func (p *LockingCircuitLoader) load(filename string, field *big.Int, reporter Reporter) (*CompiledCircuit, error) {
+	unlock := p.lockFile(filename, reporter)
+	defer unlock()
+
 	p.lock.Lock()
-	if p.locks[filename] == nil {
-		p.locks[filename] = new(sync.Mutex)
+	c, ok := p.loaded[filename]
+	partial := p.partial[filename]
+	p.lock.Unlock()
+	if ok {
+		return c, nil
 	}
+	// Report loading progress to every caller waiting on this circuit, not just
+	// the one that triggered the load.
+	fanout := &fanoutReporter{loader: p, filename: filename}
+	if partial != nil {
+		pk, err := LoadPk(p.store, filename, field, fanout)
+		if err != nil {
+			return nil, err
+		}
+		c = &CompiledCircuit{
+			Ccs: partial.Ccs,
+			Pk:  pk,
+			Vk:  partial.Vk,
+		}
+	} else {
+		ccs, pk, vk, err := Load(p.store, filename, field, false, fanout)
+		if err != nil {
+			return nil, err
+		}
+		if err = p.verifyFingerprint(filename, ccs); err != nil {
+			return nil, err
+		}
+		c = &CompiledCircuit{
+			Ccs: ccs,
+			Pk:  pk,
+			Vk:  vk,
+		}
+	}
+	p.lock.Lock()
+	p.loaded[filename] = c
+	delete(p.partial, filename)
 	p.lock.Unlock()
+	return c, nil
+}
 
-	p.locks[filename].Lock()
-	defer p.locks[filename].Unlock()
+func (p *LockingCircuitLoader) loadWithoutPk(filename string, field *big.Int, reporter Reporter) (*CompiledCircuit, error) {
+	unlock := p.lockFile(filename, reporter)
+	defer unlock()
 
-	if c, ok := p.loaded[filename]; ok {
+	p.lock.Lock()
+	c, ok := p.loaded[filename]
+	if !ok {
+		c, ok = p.partial[filename]
+	}
+	p.lock.Unlock()
+	if ok {
 		return c, nil
 	}
-	ccs, pk, vk, err := Load(p.store, filename, field, false)
+	ccs, vk, err := LoadWithoutPk(p.store, filename, field, &fanoutReporter{loader: p, filename: filename})
 	if err != nil {
 		return nil, err
 	}
-	c := &CompiledCircuit{
+	if err = p.verifyFingerprint(filename, ccs); err != nil {
+		return nil, err
+	}
+	c = &CompiledCircuit{
 		Ccs: ccs,
-		Pk:  pk,
 		Vk:  vk,
 	}
-	p.loaded[filename] = c
+	p.lock.Lock()
+	p.partial[filename] = c
+	p.lock.Unlock()
 	return c, nil
 }
+
+// VerifyCircuits checks the constraint system of every file of the given
+// circuits against its recorded fingerprint, if the loader verifies them, so
+// mismatches are caught up front rather than when a proof is requested.
+func (p *LockingCircuitLoader) VerifyCircuits(metadata []*circuits.Metadata) error {
+	if !p.verify {
+		return nil
+	}
+	for _, cm := range metadata {
+		for _, v := range cm.Versions {
+			for _, filename := range v.Filenames {
+				ccs, _, err := LoadWithoutPk(p.store, filename, cm.Field, nil)
+				if err != nil {
+					return fmt.Errorf("unable to load %s: %w", filename, err)
+				}
+				if err = p.verifyFingerprint(filename, ccs); err != nil {
+					return err
+				}
+				log.Info("Verified circuit fingerprint", "id", cm.Id, "version", v.Name, "filename", filename)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *LockingCircuitLoader) verifyFingerprint(filename string, ccs constraint.ConstraintSystem) error {
+	if !p.verify {
+		return nil
+	}
+	p.lock.Lock()
+	_, ok := p.verified[filename]
+	p.lock.Unlock()
+	if ok {
+		return nil
+	}
+	if err := VerifyFingerprint(filename, ccs); err != nil {
+		return err
+	}
+	p.lock.Lock()
+	p.verified[filename] = struct{}{}
+	p.lock.Unlock()
+	return nil
+}
+
+// lockFile takes the lock of a circuit file, registering the reporter for
+// its loading progress until the returned function is called.
+func (p *LockingCircuitLoader) lockFile(filename string, reporter Reporter) func() {
+	p.lock.Lock()
+	if p.locks[filename] == nil {
+		p.locks[filename] = new(sync.Mutex)
+	}
+	lock := p.locks[filename]
+	if reporter != nil {
+		if p.reporters[filename] == nil {
+			p.reporters[filename] = make(map[Reporter]struct{})
+		}
+		p.reporters[filename][reporter] = struct{}{}
+	}
+	p.lock.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		if reporter != nil {
+			p.lock.Lock()
+			delete(p.reporters[filename], reporter)
+			p.lock.Unlock()
+		}
+	}
+}
+
+type fanoutReporter struct {
+	loader   *LockingCircuitLoader
+	filename string
+}
+
+func (f *fanoutReporter) ReportStage(stage Stage) {}
+
+func (f *fanoutReporter) ReportLoading(p storage.Progress) {
+	f.loader.lock.Lock()
+	reporters := make([]Reporter, 0, len(f.loader.reporters[f.filename]))
+	for r := range f.loader.reporters[f.filename] {
+		reporters = append(reporters, r)
+	}
+	f.loader.lock.Unlock()
+	for _, r := range reporters {
+		r.ReportLoading(p)
+	}
+}
@@ -14,22 +14,34 @@ import (
 )
 
 type CircuitLoader interface {
-	LoadAndProve(filename string, field, outer *big.Int, wit []byte, result chan ProveResult)
-	Load(filename string, field *big.Int, result chan LoadCircuitResult)
+	LoadAndProve(filename string, field, outer *big.Int, wit []byte, reporter Reporter, result chan ProveResult)
+	Load(filename string, field *big.Int, reporter Reporter, result chan LoadCircuitResult)
+	// LoadWithoutPk loads a circuit without its proving key, or returns the
+	// fully loaded circuit if it already is.
+	LoadWithoutPk(filename string, field *big.Int, reporter Reporter, result chan LoadCircuitResult)
 	Store() storage.Storage
 }
 
 type CircuitLoaderClient struct {
-	loader CircuitLoader
+	loader   CircuitLoader
+	reporter Reporter
 }
 
-func NewCircuitLoaderClient(loader CircuitLoader) *CircuitLoaderClient {
-	return &CircuitLoaderClient{loader: loader}
+// NewCircuitLoaderClient wraps a CircuitLoader with synchronous helpers. The
+// reporter may be nil.
+func NewCircuitLoaderClient(loader CircuitLoader, reporter Reporter) *CircuitLoaderClient {
+	return &CircuitLoaderClient{loader: loader, reporter: reporter}
 }
 
-func (clc *CircuitLoaderClient) Load(cm *circuits.Metadata, txCount int) (*CompiledCircuit, error) {
+func (clc *CircuitLoaderClient) Load(cm *circuits.Metadata, v *circuits.Version, txCount int) (*CompiledCircuit, error) {
+	filename, err := cm.Filename(v, txCount)
+	if err != nil {
+		return nil, err
+	}
 	result := make(chan LoadCircuitResult, 1)
-	clc.loader.Load(cm.Filename(txCount), cm.Field, result)
+	warnDeprecated(cm, v)
+	orNop(clc.reporter).ReportStage(StageLoading)
+	clc.loader.Load(filename, cm.Field, clc.reporter, result)
 	r := <-result
 	if r.Err != nil {
 		return nil, r.Err
@@ -37,19 +49,47 @@ func (clc *CircuitLoaderClient) Load(cm *circuits.Metadata, txCount int) (*Compi
 	return r.Circuit, nil
 }
 
-func (clc *CircuitLoaderClient) LoadAndProve(cm *circuits.Metadata, txCount int, assignment frontend.Circuit) (proof plonk.Proof, err error) {
+// Solve checks an assignment against the constraints of a circuit before it is
+// proven, loading the circuit without its proving key. The returned circuit
+// has no proving key unless it was already loaded.
+func (clc *CircuitLoaderClient) Solve(cm *circuits.Metadata, v *circuits.Version, txCount int, assignment frontend.Circuit) (*CompiledCircuit, error) {
+	filename, err := cm.Filename(v, txCount)
+	if err != nil {
+		return nil, err
+	}
+	w, err := frontend.NewWitness(assignment, cm.Field)
+	if err != nil {
+		return nil, err
+	}
+	result := make(chan LoadCircuitResult, 1)
+	reporter := orNop(clc.reporter)
+	reporter.ReportStage(StageLoading)
+	clc.loader.LoadWithoutPk(filename, cm.Field, clc.reporter, result)
+	r := <-result
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	reporter.ReportStage(StageSolving)
+	if err = Solve(r.Circuit.Ccs, w); err != nil {
+		return nil, fmt.Errorf("%s: %w", cm.Id, err)
+	}
+	return r.Circuit, nil
+}
+
+func (clc *CircuitLoaderClient) LoadAndProve(cm *circuits.Metadata, v *circuits.Version, txCount int, assignment frontend.Circuit) (proof plonk.Proof, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("panic: %v, stack: %s", r, string(debug.Stack()))
 		}
 	}()
-	proof, err = clc.loadAndProve(cm, txCount, assignment)
+	proof, err = clc.loadAndProve(cm, v, txCount, assignment)
 	return
 }
 
-func (clc *CircuitLoaderClient) loadAndProve(cm *circuits.Metadata, txCount int, assignment frontend.Circuit) (plonk.Proof, error) {
-	if !cm.MultiTx {
-		txCount = 1
+func (clc *CircuitLoaderClient) loadAndProve(cm *circuits.Metadata, v *circuits.Version, txCount int, assignment frontend.Circuit) (plonk.Proof, error) {
+	filename, err := cm.Filename(v, txCount)
+	if err != nil {
+		return nil, err
 	}
 
 	w, err := frontend.NewWitness(assignment, cm.Field)
@@ -62,11 +102,13 @@ func (clc *CircuitLoaderClient) loadAndProve(cm *circuits.Metadata, txCount int,
 	}
 
 	result := make(chan ProveResult, 1)
-	log.Info("Proving", "filename", cm.Filename(txCount-1))
-	clc.loader.LoadAndProve(cm.Filename(txCount-1), cm.Field, cm.Outer, wit, result)
-	log.Info("Awaiting result", "filename", cm.Filename(txCount-1))
+	warnDeprecated(cm, v)
+	log.Info("Proving", "filename", filename)
+	orNop(clc.reporter).ReportStage(StageLoading)
+	clc.loader.LoadAndProve(filename, cm.Field, cm.Outer, wit, clc.reporter, result)
+	log.Info("Awaiting result", "filename", filename)
 	r := <-result
-	log.Info("Proof generation complete", "filename", cm.Filename(txCount-1), "error", r.Err)
+	log.Info("Proof generation complete", "filename", filename, "error", r.Err)
 	if r.Err != nil {
 		return nil, r.Err
 	}
@@ -79,5 +121,21 @@ func (clc *CircuitLoaderClient) loadAndProve(cm *circuits.Metadata, txCount int,
 	if err != nil {
 		return nil, err
 	}
+	if cm.VerificationPolicy() == circuits.VerifyNative {
+		// The circuit stays loaded after proving, so this only fetches its vk.
+		cc, err := clc.Load(cm, v, txCount)
+		if err != nil {
+			return nil, err
+		}
+		if err = VerifyNative(cm, proof, cc.Vk, assignment, clc.reporter); err != nil {
+			return nil, err
+		}
+	}
 	return proof, nil
 }
+
+func warnDeprecated(cm *circuits.Metadata, v *circuits.Version) {
+	if v.Deprecated {
+		log.Warn("Using deprecated circuit version", "id", cm.Id, "version", v.Name)
+	}
+}
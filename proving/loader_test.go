@@ -0,0 +1,88 @@
+package proving
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+)
+
+type squareCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *squareCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	return nil
+}
+
+// applyFingerprint registers the stored circuit "square" with the given
+// recorded fingerprint, or none if it is empty.
+func applyFingerprint(t *testing.T, fingerprint string) *circuits.Metadata {
+	t.Helper()
+	v := circuits.ManifestVersion{Name: "v1", Filenames: []string{"square"}}
+	if fingerprint != "" {
+		v.Fingerprints = []string{fingerprint}
+	}
+	err := circuits.ApplyManifest(&circuits.Manifest{Circuits: []circuits.ManifestCircuit{{
+		Id:       "Square",
+		Curve:    "bn254",
+		Outer:    "bn254",
+		Versions: []circuits.ManifestVersion{v},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm, err := circuits.ById("Square")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func TestLoaderVerifiesFingerprints(t *testing.T) {
+	ccs, err := Compile(&squareCircuit{}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Setup(ccs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewFileStorage(t.TempDir(), storage.FileConfig{})
+	if err = Store(store, "square", c); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := Fingerprint(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer circuits.ApplyManifest(&circuits.Manifest{})
+
+	for _, tc := range []struct {
+		name     string
+		recorded string
+		verify   bool
+		err      error
+	}{
+		{"matching", fingerprint, true, nil},
+		{"mismatching", "0x00", true, ErrFingerprintMismatch},
+		{"missing", "", true, ErrNoFingerprint},
+		{"disabled", "", false, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cm := applyFingerprint(t, tc.recorded)
+			loader := NewLockingCircuitLoader(store, tc.verify)
+			if err := loader.VerifyCircuits([]*circuits.Metadata{cm}); !errors.Is(err, tc.err) {
+				t.Fatalf("VerifyCircuits: got %v, expected %v", err, tc.err)
+			}
+			if _, err := loader.load("square", cm.Field, nil); !errors.Is(err, tc.err) {
+				t.Fatalf("load: got %v, expected %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package proving
+
+import "github.com/base-org/keyspace-recovery-service/proving/storage"
+
+type Stage string
+
+const (
+	StageQueued    Stage = "queued"
+	StageLoading   Stage = "loading"
+	StageSolving   Stage = "solving"
+	StageProving   Stage = "proving"
+	StageVerifying Stage = "verifying"
+	StageDone      Stage = "done"
+	StageFailed    Stage = "failed"
+)
+
+// Reporter receives state changes for a single proving request, so callers
+// can surface progress while a circuit is loaded and proven.
+type Reporter interface {
+	ReportStage(stage Stage)
+	ReportLoading(p storage.Progress)
+}
+
+// WitnessReporter may be implemented by a Reporter to receive the serialized
+// full witness of a circuit assignment before it is proven, e.g. to save it
+// for later replay.
+type WitnessReporter interface {
+	ReportWitness(circuitId string, wit []byte)
+}
+
+type nopReporter struct{}
+
+func (nopReporter) ReportStage(Stage)              {}
+func (nopReporter) ReportLoading(storage.Progress) {}
+
+func orNop(r Reporter) Reporter {
+	if r == nil {
+		return nopReporter{}
+	}
+	return r
+}
@@ -15,29 +15,44 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 )
 
-func Prove(c *CompiledCircuit, wit witness.Witness, field, outer *big.Int) (plonk.Proof, error) {
+func Prove(c *CompiledCircuit, wit witness.Witness, field, outer *big.Int, reporter Reporter) (plonk.Proof, error) {
+	reporter = orNop(reporter)
 	var pOpts []backend.ProverOption
-	var vOpts []backend.VerifierOption
 	if outer.Cmp(field) != 0 {
 		pOpts = append(pOpts, rplonk.GetNativeProverOptions(outer, field))
-		vOpts = append(vOpts, rplonk.GetNativeVerifierOptions(outer, field))
 	}
-	publicWitness, err := wit.Public()
-	if err != nil {
-		return nil, err
+	reporter.ReportStage(StageProving)
+	return plonk.Prove(c.Ccs, c.Pk, wit, pOpts...)
+}
+
+// VerifyNative checks a proof of a circuit with gnark if its verification
+// policy asks for it.
+func VerifyNative(cm *circuits.Metadata, proof plonk.Proof, vk plonk.VerifyingKey, assignment frontend.Circuit, reporter Reporter) error {
+	if cm.VerificationPolicy() != circuits.VerifyNative {
+		return nil
 	}
-	proof, err := plonk.Prove(c.Ccs, c.Pk, wit, pOpts...)
+	publicWitness, err := frontend.NewWitness(assignment, cm.Field, frontend.PublicOnly())
 	if err != nil {
-		return nil, err
+		return err
 	}
-	err = plonk.Verify(proof, c.Vk, publicWitness, vOpts...)
-	if err != nil {
-		return nil, err
+	orNop(reporter).ReportStage(StageVerifying)
+	if err = Verify(proof, vk, publicWitness, cm.Field, cm.Outer); err != nil {
+		return fmt.Errorf("%s: %w", cm.Id, err)
 	}
-	return proof, nil
+	return nil
 }
 
-func ProveAsync(compiled *CompiledCircuit, field, outer *big.Int, wit []byte, result chan ProveResult) {
+// Verify checks a proof against a public witness, using the hash-to-field
+// options matching the outer field the proof is meant to be recursed in.
+func Verify(proof plonk.Proof, vk plonk.VerifyingKey, publicWitness witness.Witness, field, outer *big.Int) error {
+	var vOpts []backend.VerifierOption
+	if outer.Cmp(field) != 0 {
+		vOpts = append(vOpts, rplonk.GetNativeVerifierOptions(outer, field))
+	}
+	return plonk.Verify(proof, vk, publicWitness, vOpts...)
+}
+
+func ProveAsync(compiled *CompiledCircuit, field, outer *big.Int, wit []byte, reporter Reporter, result chan ProveResult) {
 	go func() {
 		w, err := witness.New(field)
 		if err != nil {
@@ -49,7 +64,7 @@ func ProveAsync(compiled *CompiledCircuit, field, outer *big.Int, wit []byte, re
 			return
 		}
 
-		pr, err := Prove(compiled, w, field, outer)
+		pr, err := Prove(compiled, w, field, outer, reporter)
 		if err != nil {
 			result <- ProveResult{Err: err}
 			return
@@ -65,17 +80,17 @@ func ProveAsync(compiled *CompiledCircuit, field, outer *big.Int, wit []byte, re
 	}()
 }
 
-func ProveAssignment(cm circuits.Metadata, compiled *CompiledCircuit, assignment frontend.Circuit) (proof plonk.Proof, err error) {
+func ProveAssignment(cm circuits.Metadata, compiled *CompiledCircuit, assignment frontend.Circuit, reporter Reporter) (proof plonk.Proof, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("panic: %v, stack: %s", r, string(debug.Stack()))
 		}
 	}()
-	proof, err = proveAssignment(cm, compiled, assignment)
+	proof, err = proveAssignment(cm, compiled, assignment, reporter)
 	return
 }
 
-func proveAssignment(cm circuits.Metadata, compiled *CompiledCircuit, assignment frontend.Circuit) (plonk.Proof, error) {
+func proveAssignment(cm circuits.Metadata, compiled *CompiledCircuit, assignment frontend.Circuit, reporter Reporter) (plonk.Proof, error) {
 	w, err := frontend.NewWitness(assignment, cm.Field)
 	if err != nil {
 		return nil, err
@@ -84,10 +99,13 @@ func proveAssignment(cm circuits.Metadata, compiled *CompiledCircuit, assignment
 	if err != nil {
 		return nil, err
 	}
+	if wr, ok := reporter.(WitnessReporter); ok {
+		wr.ReportWitness(cm.Id, wit)
+	}
 
 	result := make(chan ProveResult, 1)
 	log.Info("Proving", "id", cm.Id)
-	ProveAsync(compiled, cm.Field, cm.Outer, wit, result)
+	ProveAsync(compiled, cm.Field, cm.Outer, wit, reporter, result)
 	log.Info("Awaiting result", "id", cm.Id)
 	r := <-result
 	log.Info("Proof generation complete", "id", cm.Id, "error", r.Err)
@@ -103,5 +121,8 @@ func proveAssignment(cm circuits.Metadata, compiled *CompiledCircuit, assignment
 	if err != nil {
 		return nil, err
 	}
+	if err = VerifyNative(&cm, proof, compiled.Vk, assignment, reporter); err != nil {
+		return nil, err
+	}
 	return proof, nil
 }
@@ -0,0 +1,136 @@
+package proving
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
+	"github.com/consensys/gnark-crypto/ecc"
+	kzgbls12377 "github.com/consensys/gnark-crypto/ecc/bls12-377/kzg"
+	kzgbn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+	kzgbw6761 "github.com/consensys/gnark-crypto/ecc/bw6-761/kzg"
+	"github.com/consensys/gnark-crypto/kzg"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/test/unsafekzg"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Compile compiles a circuit definition into a PLONK constraint system over
+// the given field.
+func Compile(circuit frontend.Circuit, field *big.Int) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(field, scs.NewBuilder, circuit)
+}
+
+// Setup runs the PLONK setup for a compiled constraint system. The KZG SRS is
+// read in canonical form from srs; if srs is nil an insecure SRS is generated,
+// which must only be used for testing.
+func Setup(ccs constraint.ConstraintSystem, srs io.Reader) (*CompiledCircuit, error) {
+	var canonical, lagrange kzg.SRS
+	var err error
+	if srs == nil {
+		log.Warn("Generating an insecure test SRS, do not use the resulting keys in production")
+		canonical, lagrange, err = unsafekzg.NewSRS(ccs)
+	} else {
+		canonical, lagrange, err = readSRS(ccs, srs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pk, vk, err := plonk.Setup(ccs, canonical, lagrange)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledCircuit{Ccs: ccs, Pk: pk, Vk: vk}, nil
+}
+
+// readSRS reads a canonical KZG SRS and truncates it to the size needed by
+// ccs, returning it together with its Lagrange form.
+func readSRS(ccs constraint.ConstraintSystem, r io.Reader) (kzg.SRS, kzg.SRS, error) {
+	sizeLagrange := ecc.NextPowerOfTwo(uint64(ccs.GetNbConstraints() + ccs.GetNbPublicVariables()))
+	sizeCanonical := sizeLagrange + 3
+
+	switch field := ccs.Field(); {
+	case field.Cmp(ecc.BLS12_377.ScalarField()) == 0:
+		srs := &kzgbls12377.SRS{}
+		if _, err := srs.ReadFrom(r); err != nil {
+			return nil, nil, fmt.Errorf("unable to read SRS: %w", err)
+		}
+		if err := checkSRSSize(len(srs.Pk.G1), sizeCanonical); err != nil {
+			return nil, nil, err
+		}
+		srs.Pk.G1 = srs.Pk.G1[:sizeCanonical]
+		g1, err := kzgbls12377.ToLagrangeG1(srs.Pk.G1[:sizeLagrange])
+		if err != nil {
+			return nil, nil, err
+		}
+		return srs, &kzgbls12377.SRS{Pk: kzgbls12377.ProvingKey{G1: g1}, Vk: srs.Vk}, nil
+	case field.Cmp(ecc.BN254.ScalarField()) == 0:
+		srs := &kzgbn254.SRS{}
+		if _, err := srs.ReadFrom(r); err != nil {
+			return nil, nil, fmt.Errorf("unable to read SRS: %w", err)
+		}
+		if err := checkSRSSize(len(srs.Pk.G1), sizeCanonical); err != nil {
+			return nil, nil, err
+		}
+		srs.Pk.G1 = srs.Pk.G1[:sizeCanonical]
+		g1, err := kzgbn254.ToLagrangeG1(srs.Pk.G1[:sizeLagrange])
+		if err != nil {
+			return nil, nil, err
+		}
+		return srs, &kzgbn254.SRS{Pk: kzgbn254.ProvingKey{G1: g1}, Vk: srs.Vk}, nil
+	case field.Cmp(ecc.BW6_761.ScalarField()) == 0:
+		srs := &kzgbw6761.SRS{}
+		if _, err := srs.ReadFrom(r); err != nil {
+			return nil, nil, fmt.Errorf("unable to read SRS: %w", err)
+		}
+		if err := checkSRSSize(len(srs.Pk.G1), sizeCanonical); err != nil {
+			return nil, nil, err
+		}
+		srs.Pk.G1 = srs.Pk.G1[:sizeCanonical]
+		g1, err := kzgbw6761.ToLagrangeG1(srs.Pk.G1[:sizeLagrange])
+		if err != nil {
+			return nil, nil, err
+		}
+		return srs, &kzgbw6761.SRS{Pk: kzgbw6761.ProvingKey{G1: g1}, Vk: srs.Vk}, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported field")
+}
+
+func checkSRSSize(size int, needed uint64) error {
+	if uint64(size) < needed {
+		return fmt.Errorf("SRS too small: has %d points, circuit needs %d", size, needed)
+	}
+	return nil
+}
+
+// Store writes the constraint system and keys of a circuit under filename,
+// using the same keys that Load reads.
+func Store(store storage.Storage, filename string, c *CompiledCircuit) error {
+	for _, t := range []struct {
+		suffix   string
+		writerTo io.WriterTo
+	}{
+		{"ccs", c.Ccs},
+		{"pk", c.Pk},
+		{"vk", c.Vk},
+	} {
+		key := fmt.Sprintf("%s.%s", filename, t.suffix)
+		log.Info(fmt.Sprintf("Writing circuit %s", t.suffix), "filename", filename)
+		w, err := store.Writer(key)
+		if err != nil {
+			return err
+		}
+		if _, err = t.writerTo.WriteTo(w); err != nil {
+			_ = storage.Abort(w)
+			return fmt.Errorf("unable to write %s: %w", key, err)
+		}
+		if err = w.Close(); err != nil {
+			return fmt.Errorf("unable to write %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package proving
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/frontend/cs"
+)
+
+// ErrUnsatisfied is returned when a witness does not satisfy the constraints
+// of a circuit, so proving it would fail.
+var ErrUnsatisfied = errors.New("witness does not satisfy the circuit")
+
+// Solve runs the constraint solver on a full witness without proving it. It
+// is much cheaper than a proof and doesn't need the proving key, so invalid
+// requests can be rejected before the proving key is loaded. The error names
+// the first unsatisfied constraint.
+func Solve(ccs constraint.ConstraintSystem, wit witness.Witness) error {
+	// The prover derives BSB22 commitments from the proving key; a random
+	// commitment is as good a challenge to check the constraints with.
+	commitment := solver.OverrideHint(solver.GetHintID(cs.Bsb22CommitmentComputePlaceholder), randomCommitment)
+	if err := ccs.IsSolved(wit, commitment); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsatisfied, err)
+	}
+	return nil
+}
+
+func randomCommitment(mod *big.Int, _ []*big.Int, output []*big.Int) error {
+	c, err := rand.Int(rand.Reader, mod)
+	if err != nil {
+		return err
+	}
+	output[0] = c
+	return nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses objects stored under their uncompressed key plus Ext, e.g.
+// "circuit.pk.zst".
+type Codec struct {
+	Name      string
+	Ext       string
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	Zstd = Codec{
+		Name: "zstd",
+		Ext:  ".zst",
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+		},
+	}
+	Gzip = Codec{
+		Name: "gzip",
+		Ext:  ".gz",
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.BestCompression)
+		},
+	}
+)
+
+// Codecs are the supported compressions, in the order Load looks for them
+// when an object is not stored uncompressed.
+var Codecs = []Codec{Zstd, Gzip}
+
+func CodecByName(name string) (Codec, error) {
+	for _, c := range Codecs {
+		if strings.EqualFold(c.Name, name) {
+			return c, nil
+		}
+	}
+	return Codec{}, fmt.Errorf("unsupported compression %q, expected zstd or gzip", name)
+}
+
+// NewDecompressingReader decompresses r, closing both the decompressor and r
+// on Close.
+func NewDecompressingReader(r io.ReadCloser, codec Codec) (io.ReadCloser, error) {
+	d, err := codec.NewReader(r)
+	if err != nil {
+		_ = r.Close()
+		return nil, fmt.Errorf("unable to decompress %s: %w", codec.Name, err)
+	}
+	return &decompressingReader{ReadCloser: d, compressed: r}, nil
+}
+
+type decompressingReader struct {
+	io.ReadCloser
+	compressed io.ReadCloser
+}
+
+func (r *decompressingReader) Close() error {
+	err := r.ReadCloser.Close()
+	if cerr := r.compressed.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrDecrypt is returned when an object cannot be authenticated, because it
+// was encrypted with another key, stored under another key, truncated or
+// tampered with.
+var ErrDecrypt = errors.New("unable to decrypt object")
+
+const (
+	encryptionMagic   = "KRSE"
+	encryptionVersion = 1
+	noncePrefixSize   = 7
+	headerSize        = len(encryptionMagic) + 1 + noncePrefixSize
+	// chunkSize is the plaintext size of every chunk but the last.
+	chunkSize = 1 << 20
+	tagSize   = 16
+)
+
+// EncryptedStorage encrypts objects with AES-GCM before they reach another
+// Storage. Objects are split into chunks that are sealed separately, so
+// multi-GB artifacts stream in constant memory, following the STREAM
+// construction: each chunk's nonce is a random per-object prefix, the chunk
+// index and a flag marking the last chunk, so chunks cannot be reordered,
+// dropped or truncated. The object key is authenticated too, so objects
+// cannot be swapped.
+//
+// An encrypted object is the header "KRSE", a version byte and the nonce
+// prefix, followed by the sealed chunks.
+type EncryptedStorage struct {
+	inner Storage
+	aead  cipher.AEAD
+}
+
+// NewEncryptedStorage wraps inner with AES-GCM encryption under key, which
+// must be 16, 24 or 32 bytes long.
+func NewEncryptedStorage(inner Storage, key []byte) (Storage, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedStorage{inner: inner, aead: aead}, nil
+}
+
+// ParseKey decodes a hex encoded AES key, ignoring surrounding whitespace.
+func ParseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("invalid encryption key: expected 16, 24 or 32 bytes, got %d", len(key))
+}
+
+// ReadKeyFile reads a hex encoded AES key from a file.
+func ReadKeyFile(path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read encryption key: %w", err)
+	}
+	return ParseKey(string(contents))
+}
+
+func (e *EncryptedStorage) Reader(key string) (io.ReadCloser, error) {
+	return e.ReaderContext(context.Background(), key)
+}
+
+func (e *EncryptedStorage) Writer(key string) (io.WriteCloser, error) {
+	return e.WriterContext(context.Background(), key)
+}
+
+func (e *EncryptedStorage) Stat(key string) (ObjectInfo, error) {
+	return e.StatContext(context.Background(), key)
+}
+
+func (e *EncryptedStorage) List(prefix string) ([]ObjectInfo, error) {
+	return e.ListContext(context.Background(), prefix)
+}
+
+func (e *EncryptedStorage) Delete(key string) error {
+	return e.DeleteContext(context.Background(), key)
+}
+
+func (e *EncryptedStorage) ReaderContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := e.inner.ReaderContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		_ = r.Close()
+		return nil, fmt.Errorf("%w %s: unable to read header: %v", ErrDecrypt, key, err)
+	}
+	if string(header[:len(encryptionMagic)]) != encryptionMagic || header[len(encryptionMagic)] != encryptionVersion {
+		_ = r.Close()
+		return nil, fmt.Errorf("%w %s: not an encrypted object", ErrDecrypt, key)
+	}
+	return &decryptingReader{
+		e:      e,
+		key:    key,
+		header: header,
+		inner:  r,
+		src:    bufio.NewReaderSize(r, chunkSize+tagSize+1),
+		size:   plaintextSize(ReaderSize(r)),
+	}, nil
+}
+
+func (e *EncryptedStorage) WriterContext(ctx context.Context, key string) (io.WriteCloser, error) {
+	header := make([]byte, headerSize)
+	copy(header, encryptionMagic)
+	header[len(encryptionMagic)] = encryptionVersion
+	if _, err := rand.Read(header[len(encryptionMagic)+1:]); err != nil {
+		return nil, err
+	}
+	w, err := e.inner.WriterContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		_ = Abort(w)
+		return nil, err
+	}
+	return &encryptingWriter{
+		e:      e,
+		key:    key,
+		header: header,
+		inner:  w,
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (e *EncryptedStorage) StatContext(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := e.inner.StatContext(ctx, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info.Size = plaintextSize(info.Size)
+	return info, nil
+}
+
+func (e *EncryptedStorage) ListContext(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects, err := e.inner.ListContext(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		objects[i].Size = plaintextSize(objects[i].Size)
+	}
+	return objects, nil
+}
+
+func (e *EncryptedStorage) DeleteContext(ctx context.Context, key string) error {
+	return e.inner.DeleteContext(ctx, key)
+}
+
+// nonce returns the nonce of a chunk, see EncryptedStorage.
+func nonce(header []byte, index uint32, last bool) []byte {
+	n := make([]byte, 0, noncePrefixSize+5)
+	n = append(n, header[len(encryptionMagic)+1:]...)
+	n = binary.BigEndian.AppendUint32(n, index)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+// additionalData binds chunks to the header and key of their object.
+func additionalData(header []byte, key string) []byte {
+	return append(bytes.Clone(header), key...)
+}
+
+// plaintextSize returns the size of the object an encrypted object of size
+// bytes decrypts to, or 0 if size is unknown or invalid.
+func plaintextSize(size int64) int64 {
+	n := size - int64(headerSize)
+	if n < tagSize {
+		return 0
+	}
+	chunks := (n + chunkSize + tagSize - 1) / (chunkSize + tagSize)
+	return n - chunks*tagSize
+}
+
+type encryptingWriter struct {
+	e      *EncryptedStorage
+	key    string
+	header []byte
+	inner  io.WriteCloser
+	buf    []byte
+	index  uint32
+	err    error
+}
+
+func (w *encryptingWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		if w.err != nil {
+			return written, w.err
+		}
+		// A full chunk is only sealed once more data arrives, as the last
+		// chunk is sealed differently.
+		if len(w.buf) == chunkSize {
+			w.err = w.seal(false)
+			continue
+		}
+		n := copy(w.buf[len(w.buf):chunkSize], b)
+		w.buf = w.buf[:len(w.buf)+n]
+		b = b[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *encryptingWriter) seal(last bool) error {
+	if w.index == ^uint32(0) {
+		return errors.New("object too large to encrypt")
+	}
+	sealed := w.e.aead.Seal(nil, nonce(w.header, w.index, last), w.buf, additionalData(w.header, w.key))
+	w.index++
+	w.buf = w.buf[:0]
+	_, err := w.inner.Write(sealed)
+	return err
+}
+
+// Close seals the last chunk, or aborts the inner writer if a write failed.
+func (w *encryptingWriter) Close() error {
+	err := w.err
+	if err == nil {
+		err = w.seal(true)
+	}
+	if err != nil {
+		_ = Abort(w.inner)
+		return err
+	}
+	return w.inner.Close()
+}
+
+func (w *encryptingWriter) Abort() error {
+	return Abort(w.inner)
+}
+
+type decryptingReader struct {
+	e      *EncryptedStorage
+	key    string
+	header []byte
+	inner  io.ReadCloser
+	src    *bufio.Reader
+	size   int64
+	index  uint32
+	chunk  []byte
+	cur    []byte
+	done   bool
+	err    error
+}
+
+func (r *decryptingReader) Read(b []byte) (int, error) {
+	for len(r.cur) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.open()
+	}
+	n := copy(b, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+// open reads and authenticates the next chunk. A chunk is the last one if
+// nothing follows it.
+func (r *decryptingReader) open() error {
+	if r.chunk == nil {
+		r.chunk = make([]byte, chunkSize+tagSize)
+	}
+	n, err := io.ReadFull(r.src, r.chunk)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		r.done = true
+	} else if err != nil {
+		return err
+	} else if _, err = r.src.Peek(1); errors.Is(err, io.EOF) {
+		r.done = true
+	} else if err != nil {
+		return err
+	}
+	plain, err := r.e.aead.Open(r.chunk[:0], nonce(r.header, r.index, r.done), r.chunk[:n], additionalData(r.header, r.key))
+	if err != nil {
+		return fmt.Errorf("%w %s: chunk %d failed authentication", ErrDecrypt, r.key, r.index)
+	}
+	r.index++
+	r.cur = plain
+	return nil
+}
+
+func (r *decryptingReader) Size() int64 {
+	return r.size
+}
+
+func (r *decryptingReader) Close() error {
+	return r.inner.Close()
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+var testEncryptionKey = bytes.Repeat([]byte{0x42}, 32)
+
+// newEncryptedTestStorage returns an encrypted storage with the file storage
+// it wraps, so tests can tamper with the ciphertext.
+func newEncryptedTestStorage(t *testing.T) (Storage, Storage) {
+	t.Helper()
+	inner := NewFileStorage(t.TempDir(), FileConfig{})
+	s, err := NewEncryptedStorage(inner, testEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, inner
+}
+
+// testPlaintext spans two full chunks and a partial last one.
+func testPlaintext() []byte {
+	b := make([]byte, 2*chunkSize+1000)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+func readDecrypted(s Storage, key string) ([]byte, error) {
+	r, err := s.Reader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestEncryptedStorageRoundTrip(t *testing.T) {
+	s, inner := newEncryptedTestStorage(t)
+	for _, data := range [][]byte{nil, []byte("small"), make([]byte, chunkSize), testPlaintext()} {
+		writeObject(t, s, "a.pk", data)
+		got, err := readDecrypted(s, "a.pk")
+		if err != nil {
+			t.Fatalf("%d bytes: %v", len(data), err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%d bytes: wrong plaintext", len(data))
+		}
+		info, err := s.Stat("a.pk")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size != int64(len(data)) {
+			t.Fatalf("%d bytes: Stat size %d", len(data), info.Size)
+		}
+		if bytes.Contains(readObject(t, inner, "a.pk"), []byte("small")) {
+			t.Fatal("plaintext stored unencrypted")
+		}
+	}
+}
+
+func TestEncryptedStorageRejectsTampering(t *testing.T) {
+	sealedChunk := chunkSize + tagSize
+	for name, tamper := range map[string]func([]byte) []byte{
+		"truncated at a chunk boundary": func(b []byte) []byte {
+			return b[:headerSize+2*sealedChunk]
+		},
+		"truncated within a chunk": func(b []byte) []byte {
+			return b[:len(b)-10]
+		},
+		"header only": func(b []byte) []byte {
+			return b[:headerSize]
+		},
+		"chunks reordered": func(b []byte) []byte {
+			chunks := b[headerSize:]
+			res := append([]byte{}, b[:headerSize]...)
+			res = append(res, chunks[sealedChunk:2*sealedChunk]...)
+			res = append(res, chunks[:sealedChunk]...)
+			return append(res, chunks[2*sealedChunk:]...)
+		},
+		"chunk dropped": func(b []byte) []byte {
+			return append(append([]byte{}, b[:headerSize+sealedChunk]...), b[headerSize+2*sealedChunk:]...)
+		},
+		"byte flipped": func(b []byte) []byte {
+			b[headerSize+sealedChunk+5] ^= 1
+			return b
+		},
+		"nonce changed": func(b []byte) []byte {
+			b[headerSize-1] ^= 1
+			return b
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, inner := newEncryptedTestStorage(t)
+			writeObject(t, s, "a.pk", testPlaintext())
+			writeObject(t, inner, "a.pk", tamper(readObject(t, inner, "a.pk")))
+			if _, err := readDecrypted(s, "a.pk"); !errors.Is(err, ErrDecrypt) {
+				t.Fatalf("got %v, expected %v", err, ErrDecrypt)
+			}
+		})
+	}
+}
+
+func TestEncryptedStorageBindsObjectKey(t *testing.T) {
+	s, inner := newEncryptedTestStorage(t)
+	writeObject(t, s, "a.pk", []byte("a"))
+	writeObject(t, inner, "b.pk", readObject(t, inner, "a.pk"))
+	if _, err := readDecrypted(s, "b.pk"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("swapped object: got %v, expected %v", err, ErrDecrypt)
+	}
+
+	other, err := NewEncryptedStorage(inner, bytes.Repeat([]byte{0x24}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readDecrypted(other, "a.pk"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("wrong key: got %v, expected %v", err, ErrDecrypt)
+	}
+}
+
+func TestEncryptedStorageAbortDiscardsObject(t *testing.T) {
+	s, inner := newEncryptedTestStorage(t)
+	w, err := s.Writer("a.pk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(testPlaintext()); err != nil {
+		t.Fatal(err)
+	}
+	if err = Abort(w); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = inner.Stat("a.pk"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("aborted object was committed: %v", err)
+	}
+}
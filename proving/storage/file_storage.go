@@ -1,27 +1,339 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
+// ErrInvalidKey is returned for keys that are not a clean relative path
+// inside the storage, such as absolute paths or keys containing "..". Path
+// elements starting with "." are reserved for in-progress writes.
+var ErrInvalidKey = errors.New("invalid storage key")
+
+const (
+	DefaultFileMode = 0o644
+	DefaultDirMode  = 0o755
+)
+
+// FileConfig configures a FileStorage. Zero values use the defaults.
+type FileConfig struct {
+	// Shards is the number of levels of two-character subdirectories objects
+	// are spread over, e.g. ab/cd/abcdef... with 2, to keep directories small.
+	// Objects written before sharding was enabled are still found at the top
+	// level.
+	Shards int
+	// FileMode and DirMode are the permissions of written files and of the
+	// directories created for them.
+	FileMode fs.FileMode
+	DirMode  fs.FileMode
+	// Mmap makes the storage a Mapper, so circuits are loaded from
+	// memory-mapped files rather than read into the heap.
+	Mmap bool
+}
+
+// FileStorage stores objects as files under a directory. Writes go to a
+// temporary file that is synced and renamed into place on Close, so a crash
+// mid-write never leaves a truncated object behind. Failed and aborted writes
+// are discarded.
 type FileStorage struct {
 	path string
+	cfg  FileConfig
 }
 
-func NewFileStorage(path string) Storage {
-	return &FileStorage{path: path}
+func NewFileStorage(path string, cfg FileConfig) Storage {
+	if cfg.FileMode == 0 {
+		cfg.FileMode = DefaultFileMode
+	}
+	if cfg.DirMode == 0 {
+		cfg.DirMode = DefaultDirMode
+	}
+	return &FileStorage{path: path, cfg: cfg}
 }
 
 func (f *FileStorage) Reader(key string) (io.ReadCloser, error) {
-	return os.Open(f.filename(key))
+	return f.ReaderContext(context.Background(), key)
 }
 
 func (f *FileStorage) Writer(key string) (io.WriteCloser, error) {
-	return os.Create(f.filename(key))
+	return f.WriterContext(context.Background(), key)
+}
+
+func (f *FileStorage) Stat(key string) (ObjectInfo, error) {
+	return f.StatContext(context.Background(), key)
+}
+
+func (f *FileStorage) List(prefix string) ([]ObjectInfo, error) {
+	return f.ListContext(context.Background(), prefix)
+}
+
+func (f *FileStorage) Delete(key string) error {
+	return f.DeleteContext(context.Background(), key)
+}
+
+// Map memory-maps an object, or returns ErrMmapUnsupported if mapping is
+// disabled or unavailable on this platform.
+func (f *FileStorage) Map(key string) (*Mapping, error) {
+	if !f.cfg.Mmap {
+		return nil, ErrMmapUnsupported
+	}
+	filename, err := f.existing(key)
+	if err != nil {
+		return nil, err
+	}
+	return mmapFile(filename)
+}
+
+func (f *FileStorage) ReaderContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filename, err := f.existing(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &contextReader{ReadCloser: file, ctx: ctx}, nil
+}
+
+func (f *FileStorage) WriterContext(ctx context.Context, key string) (io.WriteCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filename, err := f.filename(key)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(filename)
+	if err = os.MkdirAll(dir, f.cfg.DirMode); err != nil {
+		return nil, err
+	}
+	// Dot files are skipped by List, so partial writes are never listed.
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicWriter{File: tmp, ctx: ctx, filename: filename, mode: f.cfg.FileMode}, nil
+}
+
+func (f *FileStorage) StatContext(ctx context.Context, key string) (ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return ObjectInfo{}, err
+	}
+	filename, err := f.existing(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%s is a directory: %w", key, ErrNotExist)
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (f *FileStorage) ListContext(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(f.path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(f.path, p)
+		if err != nil {
+			return err
+		}
+		key := f.unshard(filepath.ToSlash(rel))
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+func (f *FileStorage) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	filename, err := f.existing(key)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = os.Remove(filename); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// filename returns the path an object is written to.
+func (f *FileStorage) filename(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, "\\\x00") || path.IsAbs(key) || path.Clean(key) != key {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, elem := range strings.Split(key, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return filepath.Join(f.path, filepath.FromSlash(f.shard(key))), nil
+}
+
+// existing returns the path of an existing object, falling back to the top
+// level for objects written before sharding was enabled.
+func (f *FileStorage) existing(key string) (string, error) {
+	filename, err := f.filename(key)
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Stat(filename); errors.Is(err, ErrNotExist) && f.cfg.Shards > 0 {
+		flat := filepath.Join(f.path, filepath.FromSlash(key))
+		if _, err := os.Stat(flat); err == nil {
+			return flat, nil
+		}
+	}
+	return filename, nil
+}
+
+// shard prefixes the last element of a key with its sharding directories.
+func (f *FileStorage) shard(key string) string {
+	dir, base := path.Split(key)
+	if len(base) <= 2*f.cfg.Shards {
+		return key
+	}
+	var shards []string
+	for i := 0; i < f.cfg.Shards; i++ {
+		shards = append(shards, base[2*i:2*i+2])
+	}
+	return dir + path.Join(append(shards, base)...)
+}
+
+// unshard reverses shard for a path relative to the storage directory.
+func (f *FileStorage) unshard(rel string) string {
+	dir, base := path.Split(rel)
+	prefix := path.Clean(dir)
+	for i := f.cfg.Shards - 1; i >= 0; i-- {
+		if len(base) < 2*i+2 || base[2*i:2*i+2] != path.Base(prefix) {
+			return rel
+		}
+		prefix = path.Dir(prefix)
+	}
+	if prefix == "." {
+		return base
+	}
+	return prefix + "/" + base
+}
+
+// atomicWriter writes an object to a temporary file and renames it into place
+// once it is complete and synced. If a write failed, or the writer is
+// aborted, the temporary file is removed instead.
+type atomicWriter struct {
+	*os.File
+	ctx      context.Context
+	filename string
+	mode     fs.FileMode
+	err      error
+	closed   bool
+}
+
+func (w *atomicWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if err := w.ctx.Err(); err != nil {
+		w.err = err
+		return 0, err
+	}
+	n, err := w.File.Write(b)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Close commits the object, unless a write failed, in which case it is
+// discarded and the write error returned.
+func (w *atomicWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	if w.err != nil {
+		err := w.err
+		_ = w.Abort()
+		return err
+	}
+	w.closed = true
+	err := w.commit()
+	if err != nil {
+		_ = os.Remove(w.File.Name())
+	}
+	return err
+}
+
+// Abort discards the object, removing the temporary file.
+func (w *atomicWriter) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	_ = w.File.Close()
+	return os.Remove(w.File.Name())
 }
 
-func (f *FileStorage) filename(vkHash string) string {
-	return fmt.Sprintf("%s/%s", f.path, vkHash)
+func (w *atomicWriter) commit() error {
+	if err := w.ctx.Err(); err != nil {
+		_ = w.File.Close()
+		return err
+	}
+	if err := w.File.Chmod(w.mode); err != nil {
+		_ = w.File.Close()
+		return err
+	}
+	if err := w.File.Sync(); err != nil {
+		_ = w.File.Close()
+		return err
+	}
+	if err := w.File.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(w.File.Name(), w.filename); err != nil {
+		return err
+	}
+	// Sync the directory so the rename itself survives a crash.
+	dir, err := os.Open(filepath.Dir(w.filename))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
 }
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeObject(t *testing.T, s Storage, key string, data []byte) {
+	t.Helper()
+	w, err := s.Writer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readObject(t *testing.T, s Storage, key string) []byte {
+	t.Helper()
+	r, err := s.Reader(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// assertNoTempFiles fails if an in-progress write was left behind.
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && d.Name()[0] == '.' {
+			t.Errorf("temporary file left behind: %s", p)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAtomicWriterCommitsOnClose(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStorage(dir, FileConfig{})
+	w, err := s.Writer("a.pk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Stat("a.pk"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("object visible before Close: %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, s, "a.pk"); string(got) != "partial" {
+		t.Fatalf("got %q", got)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestAtomicWriterAbortKeepsPreviousObject(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStorage(dir, FileConfig{})
+	writeObject(t, s, "a.pk", []byte("previous"))
+
+	w, err := s.Writer("a.pk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("truncated")); err != nil {
+		t.Fatal(err)
+	}
+	if err = Abort(w); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close after Abort: %v", err)
+	}
+	if got := readObject(t, s, "a.pk"); string(got) != "previous" {
+		t.Fatalf("got %q", got)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestAtomicWriterDiscardsFailedWrites(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStorage(dir, FileConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := s.WriterContext(ctx, "a.pk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err = w.Write([]byte("second")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Write: got %v", err)
+	}
+	if err = w.Close(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Close: got %v", err)
+	}
+	if _, err = s.Stat("a.pk"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("failed write was committed: %v", err)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestFileStorageSharding(t *testing.T) {
+	dir := t.TempDir()
+	flat := NewFileStorage(dir, FileConfig{})
+	writeObject(t, flat, "abcdef.vk", []byte("flat"))
+
+	s := NewFileStorage(dir, FileConfig{Shards: 2})
+	writeObject(t, s, "123456.vk", []byte("sharded"))
+	if _, err := os.Stat(filepath.Join(dir, "12", "34", "123456.vk")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, s, "abcdef.vk"); !bytes.Equal(got, []byte("flat")) {
+		t.Fatalf("unsharded object: got %q", got)
+	}
+
+	objects, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+	if len(keys) != 2 || keys[0] != "123456.vk" || keys[1] != "abcdef.vk" {
+		t.Fatalf("got keys %v", keys)
+	}
+}
+
+func TestFileStorageRejectsInvalidKeys(t *testing.T) {
+	s := NewFileStorage(t.TempDir(), FileConfig{})
+	for _, key := range []string{"", "/etc/passwd", "../a", "a/../b", "a//b", ".hidden", "a/.tmp", "a\\b"} {
+		if _, err := s.Writer(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Writer(%q): got %v", key, err)
+		}
+	}
+}
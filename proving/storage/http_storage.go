@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ErrReadOnly is returned when writing to or deleting from a read-only
+// storage.
+var ErrReadOnly = errors.New("storage is read-only")
+
+// ErrChecksum is returned when a downloaded object doesn't match its expected
+// content hash.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// ErrNoChecksum is returned when an object has no known content hash and
+// HTTPConfig.RequireChecksum is set.
+var ErrNoChecksum = errors.New("no checksum to verify against")
+
+const (
+	DefaultHTTPMaxRetries = 5
+	// checksumFetchTimeout bounds fetching the checksum file, which is shared
+	// by all requests rather than tied to the one that triggered it.
+	checksumFetchTimeout = time.Minute
+)
+
+// HTTPConfig configures an HTTPStorage. Zero values use the defaults.
+type HTTPConfig struct {
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// ChecksumFile is the key of a sha256sum-style file next to the objects,
+	// listing the expected SHA-256 hash of each of them. Objects are verified
+	// against it and it backs List. Empty disables it.
+	ChecksumFile string
+	// MaxRetries is the number of times an interrupted download is resumed;
+	// negative disables retries.
+	MaxRetries int
+	// RequireChecksum rejects objects that can't be verified, neither by the
+	// checksum file nor by a raw-leaf CID, instead of logging a warning.
+	RequireChecksum bool
+}
+
+// HTTPStorage is a read-only storage fetching objects from <base-url>/<key>,
+// e.g. the IPFS gateway circuits are published on. Interrupted downloads are
+// resumed with range requests. If the base URL is an IPFS path
+// (/ipfs/<cid>/...), gateway responses must carry that root CID, and objects
+// whose ETag is a raw-leaf CID are verified against its SHA-256 digest. Other
+// CIDs, such as chunked UnixFS files, can only be verified with a checksum
+// file.
+type HTTPStorage struct {
+	base    *url.URL
+	cfg     HTTPConfig
+	rootCID string
+
+	checksumsLock  sync.Mutex
+	checksums      map[string][]byte
+	checksumsFetch *checksumFetch
+}
+
+// checksumFetch is an in-progress fetch of the checksum file, whose result is
+// available once done is closed.
+type checksumFetch struct {
+	done      chan struct{}
+	checksums map[string][]byte
+	err       error
+}
+
+func NewHTTPStorage(baseURL string, cfg HTTPConfig) (Storage, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %s: expected http or https", baseURL)
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultHTTPMaxRetries
+	}
+	h := &HTTPStorage{base: base, cfg: cfg}
+	if segments := strings.Split(strings.TrimPrefix(base.Path, "/"), "/"); len(segments) >= 2 && segments[0] == "ipfs" {
+		h.rootCID = segments[1]
+	}
+	return h, nil
+}
+
+func (h *HTTPStorage) Reader(key string) (io.ReadCloser, error) {
+	return h.ReaderContext(context.Background(), key)
+}
+
+func (h *HTTPStorage) Writer(key string) (io.WriteCloser, error) {
+	return h.WriterContext(context.Background(), key)
+}
+
+func (h *HTTPStorage) Stat(key string) (ObjectInfo, error) {
+	return h.StatContext(context.Background(), key)
+}
+
+func (h *HTTPStorage) List(prefix string) ([]ObjectInfo, error) {
+	return h.ListContext(context.Background(), prefix)
+}
+
+func (h *HTTPStorage) Delete(key string) error {
+	return h.DeleteContext(context.Background(), key)
+}
+
+func (h *HTTPStorage) ReaderContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	expected, err := h.checksum(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	r := &httpReader{
+		h:        h,
+		ctx:      ctx,
+		key:      key,
+		body:     resp.Body,
+		etag:     resp.Header.Get("ETag"),
+		size:     resp.ContentLength,
+		hash:     sha256.New(),
+		expected: expected,
+	}
+	if h.rootCID != "" && r.expected == nil {
+		r.expected = rawLeafDigest(r.etag)
+	}
+	if r.expected == nil && key != h.cfg.ChecksumFile {
+		if h.cfg.RequireChecksum {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("%s: %w", key, ErrNoChecksum)
+		}
+		log.Warn("Downloading unverified object, its content hash is unknown", "key", key, "etag", r.etag)
+	}
+	return NewProgressReader(r, NewProgressTracker(key, max(r.size, 0)).Subscribe(DefaultLogInterval, LogProgress("Downloading"))), nil
+}
+
+func (h *HTTPStorage) WriterContext(context.Context, string) (io.WriteCloser, error) {
+	return nil, ErrReadOnly
+}
+
+func (h *HTTPStorage) StatContext(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := h.do(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	_ = resp.Body.Close()
+	info := ObjectInfo{Key: key, Size: max(resp.ContentLength, 0)}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modified
+	}
+	return info, nil
+}
+
+// ListContext lists the objects of the checksum file, as plain HTTP has no
+// way to enumerate objects. Sizes are not known without a Stat.
+func (h *HTTPStorage) ListContext(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	if h.cfg.ChecksumFile == "" {
+		return nil, fmt.Errorf("listing objects over HTTP without a checksum file: %w", errors.ErrUnsupported)
+	}
+	checksums, err := h.loadChecksums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var objects []ObjectInfo
+	for key := range checksums {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{Key: key})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+func (h *HTTPStorage) DeleteContext(context.Context, string) error {
+	return ErrReadOnly
+}
+
+// do sends a request for key and checks the response status, mapping 404 to
+// ErrNotExist. The caller must close the body of the response.
+func (h *HTTPStorage) do(ctx context.Context, method, key string, header http.Header) (*http.Response, error) {
+	u := h.base.JoinPath(key)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := h.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %w", u, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", u, ErrNotExist)
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent:
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unable to fetch %s: %s", u, resp.Status)
+	}
+	if err = h.checkRoot(resp); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// checkRoot rejects IPFS gateway responses resolved from another root CID
+// than the one in the base URL.
+func (h *HTTPStorage) checkRoot(resp *http.Response) error {
+	roots := resp.Header.Get("X-Ipfs-Roots")
+	if h.rootCID == "" || roots == "" {
+		return nil
+	}
+	if root := strings.TrimSpace(strings.Split(roots, ",")[0]); root != h.rootCID {
+		return fmt.Errorf("gateway resolved %s from root %s, expected %s", resp.Request.URL, root, h.rootCID)
+	}
+	return nil
+}
+
+// checksum returns the expected SHA-256 hash of an object, or nil if it is
+// not known.
+func (h *HTTPStorage) checksum(ctx context.Context, key string) ([]byte, error) {
+	if h.cfg.ChecksumFile == "" || key == h.cfg.ChecksumFile {
+		return nil, nil
+	}
+	checksums, err := h.loadChecksums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return checksums[key], nil
+}
+
+// loadChecksums returns the checksum file, fetching it if it isn't cached
+// yet. Concurrent callers share one fetch, which isn't cancelled with the
+// context of any of them, and only a successful fetch is cached so a failed
+// one is retried by the next caller.
+func (h *HTTPStorage) loadChecksums(ctx context.Context) (map[string][]byte, error) {
+	h.checksumsLock.Lock()
+	if h.checksums != nil {
+		h.checksumsLock.Unlock()
+		return h.checksums, nil
+	}
+	f := h.checksumsFetch
+	if f == nil {
+		f = &checksumFetch{done: make(chan struct{})}
+		h.checksumsFetch = f
+		go h.fetchChecksumsAsync(f)
+	}
+	h.checksumsLock.Unlock()
+	select {
+	case <-f.done:
+		return f.checksums, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (h *HTTPStorage) fetchChecksumsAsync(f *checksumFetch) {
+	ctx, cancel := context.WithTimeout(context.Background(), checksumFetchTimeout)
+	defer cancel()
+	f.checksums, f.err = h.fetchChecksums(ctx)
+	h.checksumsLock.Lock()
+	if f.err == nil {
+		h.checksums = f.checksums
+	}
+	h.checksumsFetch = nil
+	h.checksumsLock.Unlock()
+	close(f.done)
+}
+
+// fetchChecksums parses the checksum file, in the "<hex>  <key>" format of
+// sha256sum.
+func (h *HTTPStorage) fetchChecksums(ctx context.Context) (map[string][]byte, error) {
+	resp, err := h.do(ctx, http.MethodGet, h.cfg.ChecksumFile, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch checksum file: %w", err)
+	}
+	defer resp.Body.Close()
+	checksums := make(map[string][]byte)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, key, ok := strings.Cut(line, " ")
+		digest, err := hex.DecodeString(sum)
+		if !ok || err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid line in checksum file: %q", line)
+		}
+		checksums[strings.TrimPrefix(strings.TrimSpace(key), "*")] = digest
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read checksum file: %w", err)
+	}
+	return checksums, nil
+}
+
+// httpReader reads an HTTP response body, resuming the download with a range
+// request when it is interrupted, and verifies the content hash at the end.
+type httpReader struct {
+	h        *HTTPStorage
+	ctx      context.Context
+	key      string
+	body     io.ReadCloser
+	etag     string
+	size     int64
+	n        int64
+	retries  int
+	hash     hash.Hash
+	expected []byte
+}
+
+func (r *httpReader) Read(b []byte) (int, error) {
+	for {
+		n, err := r.body.Read(b)
+		r.n += int64(n)
+		r.hash.Write(b[:n])
+		if err == io.EOF && r.size > 0 && r.n < r.size {
+			err = io.ErrUnexpectedEOF
+		}
+		switch {
+		case err == nil:
+			return n, nil
+		case err == io.EOF:
+			if r.expected != nil && !bytes.Equal(r.hash.Sum(nil), r.expected) {
+				return n, fmt.Errorf("%s: %w", r.key, ErrChecksum)
+			}
+			return n, io.EOF
+		case n > 0:
+			// Return what was read; the error comes back on the next call.
+			return n, nil
+		}
+		if err = r.resume(err); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// resume requests the rest of the object after a failed read, returning the
+// original error if the download can't be resumed.
+func (r *httpReader) resume(cause error) error {
+	if r.retries >= r.h.cfg.MaxRetries || r.ctx.Err() != nil || r.etag == "" || strings.HasPrefix(r.etag, "W/") {
+		return fmt.Errorf("unable to download %s: %w", r.key, cause)
+	}
+	r.retries++
+	delay := time.Duration(1<<(r.retries-1)) * 100 * time.Millisecond
+	log.Warn("Resuming HTTP download", "key", r.key, "offset", r.n, "attempt", r.retries, "delay", delay, "error", cause)
+	select {
+	case <-time.After(delay):
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+	_ = r.body.Close()
+	resp, err := r.h.do(r.ctx, http.MethodGet, r.key, http.Header{
+		"Range":    {fmt.Sprintf("bytes=%d-", r.n)},
+		"If-Range": {r.etag},
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusPartialContent || !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", r.n)) {
+		_ = resp.Body.Close()
+		return fmt.Errorf("unable to resume %s at byte %d: the server did not return the requested range", r.key, r.n)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *httpReader) Size() int64 {
+	return r.size
+}
+
+func (r *httpReader) Close() error {
+	return r.body.Close()
+}
+
+// rawLeafDigest returns the SHA-256 digest of an ETag holding a base32 CIDv1
+// of a raw block, which is the hash of the object's content, or nil for other
+// CIDs such as chunked UnixFS files.
+func rawLeafDigest(etag string) []byte {
+	cid := strings.Trim(etag, `"`)
+	if !strings.HasPrefix(cid, "b") {
+		return nil
+	}
+	b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(cid[1:]))
+	if err != nil {
+		return nil
+	}
+	var fields [4]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil
+		}
+		fields[i], b = v, b[n:]
+	}
+	// CID version, raw codec, sha2-256 multihash and digest length.
+	if fields != [4]uint64{1, 0x55, 0x12, sha256.Size} || len(b) != sha256.Size {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// httpObjects serves objects like a gateway, with strong ETags so downloads
+// can be resumed.
+type httpObjects map[string][]byte
+
+func (o httpObjects) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, ok := o[strings.TrimPrefix(r.URL.Path, "/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256(data)))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+func checksumFile(objects map[string][]byte) []byte {
+	var b bytes.Buffer
+	for key, data := range objects {
+		fmt.Fprintf(&b, "%x  %s\n", sha256.Sum256(data), key)
+	}
+	return b.Bytes()
+}
+
+func readHTTP(s Storage, key string) ([]byte, error) {
+	r, err := s.Reader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestHTTPStorageResumesDownloads(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	objects := httpObjects{"a.pk": data}
+	var interrupted atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "" && !interrupted.Swap(true) {
+			// Send half of the object, then drop the connection.
+			w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256(data)))
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+			_, _ = w.Write(data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		objects.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	s, err := NewHTTPStorage(server.URL, HTTPConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readHTTP(s, "a.pk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !interrupted.Load() || !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, expected %d", len(got), len(data))
+	}
+}
+
+func TestHTTPStorageChecksumMismatch(t *testing.T) {
+	objects := httpObjects{"a.pk": []byte("tampered"), "b.pk": []byte("intact")}
+	objects["SHA256SUMS"] = checksumFile(map[string][]byte{"a.pk": []byte("original"), "b.pk": []byte("intact")})
+	server := httptest.NewServer(objects)
+	defer server.Close()
+
+	s, err := NewHTTPStorage(server.URL, HTTPConfig{ChecksumFile: "SHA256SUMS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readHTTP(s, "a.pk"); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("got %v, expected %v", err, ErrChecksum)
+	}
+	if got, err := readHTTP(s, "b.pk"); err != nil || string(got) != "intact" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+// rawLeafCID returns the base32 CIDv1 of data stored as a raw block.
+func rawLeafCID(data []byte) string {
+	digest := sha256.Sum256(data)
+	cid := append([]byte{1, 0x55, 0x12, sha256.Size}, digest[:]...)
+	return "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(cid))
+}
+
+func TestHTTPStorageRawLeafCID(t *testing.T) {
+	const root = "bafyroot"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ipfs-Roots", root)
+		w.Header().Set("ETag", `"`+rawLeafCID([]byte("original"))+`"`)
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/ipfs/"+root+"/")))
+	}))
+	defer server.Close()
+
+	s, err := NewHTTPStorage(server.URL+"/ipfs/"+root, HTTPConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readHTTP(s, "original"); err != nil || string(got) != "original" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if _, err = readHTTP(s, "tampered"); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("got %v, expected %v", err, ErrChecksum)
+	}
+}
+
+func TestHTTPStorageRequireChecksum(t *testing.T) {
+	objects := httpObjects{"a.pk": []byte("listed"), "b.pk": []byte("unlisted")}
+	objects["SHA256SUMS"] = checksumFile(map[string][]byte{"a.pk": objects["a.pk"]})
+	server := httptest.NewServer(objects)
+	defer server.Close()
+
+	s, err := NewHTTPStorage(server.URL, HTTPConfig{ChecksumFile: "SHA256SUMS", RequireChecksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readHTTP(s, "a.pk"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readHTTP(s, "b.pk"); !errors.Is(err, ErrNoChecksum) {
+		t.Fatalf("got %v, expected %v", err, ErrNoChecksum)
+	}
+}
+
+func TestHTTPStorageNotFound(t *testing.T) {
+	server := httptest.NewServer(httpObjects{})
+	defer server.Close()
+
+	s, err := NewHTTPStorage(server.URL, HTTPConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Reader("missing.pk"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Reader: got %v, expected %v", err, ErrNotExist)
+	}
+	if _, err = s.Stat("missing.pk"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Stat: got %v, expected %v", err, ErrNotExist)
+	}
+}
+
+func TestHTTPStorageRetriesFailedChecksumFetch(t *testing.T) {
+	objects := httpObjects{"a.pk": []byte("data")}
+	objects["SHA256SUMS"] = checksumFile(map[string][]byte{"a.pk": objects["a.pk"]})
+	var failures atomic.Int32
+	failures.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/SHA256SUMS" && failures.Add(-1) >= 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		objects.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	s, err := NewHTTPStorage(server.URL, HTTPConfig{ChecksumFile: "SHA256SUMS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.List(""); err == nil {
+		t.Fatal("expected the first checksum fetch to fail")
+	}
+	objectsList, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objectsList) != 1 || objectsList[0].Key != "a.pk" {
+		t.Fatalf("got %v", objectsList)
+	}
+
+	// A fetch is not cancelled with the context of the caller that started it.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s, _ = NewHTTPStorage(server.URL, HTTPConfig{ChecksumFile: "SHA256SUMS"})
+	if _, err = s.ListContext(ctx, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v", err)
+	}
+	if _, err = s.List(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRawLeafDigest(t *testing.T) {
+	digest := sha256.Sum256([]byte("data"))
+	if got := rawLeafDigest(`"` + rawLeafCID([]byte("data")) + `"`); hex.EncodeToString(got) != hex.EncodeToString(digest[:]) {
+		t.Fatalf("got %x", got)
+	}
+	// A CIDv0, as chunked UnixFS files are addressed by.
+	if got := rawLeafDigest(`"QmSpJsRbMZdKYjMG25pPa16e4pdLnQbGGtZGTRBmYZDuW7"`); got != nil {
+		t.Fatalf("got %x", got)
+	}
+}
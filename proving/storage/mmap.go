@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+)
+
+// ErrMmapUnsupported is returned by Mapper.Map when the storage or platform
+// cannot memory-map objects; callers fall back to Reader.
+var ErrMmapUnsupported = errors.New("memory-mapping is not supported")
+
+// Mapper may be implemented by a Storage that can memory-map objects, so large
+// artifacts are deserialized straight from the page cache instead of first
+// being copied to the heap.
+type Mapper interface {
+	Map(key string) (*Mapping, error)
+}
+
+// Mapping is a read-only memory-mapped object. Its bytes must not be used
+// after Close.
+type Mapping struct {
+	data  []byte
+	unmap func() error
+}
+
+func (m *Mapping) Bytes() []byte {
+	return m.data
+}
+
+func (m *Mapping) Close() error {
+	if m.unmap == nil {
+		return nil
+	}
+	unmap := m.unmap
+	m.data, m.unmap = nil, nil
+	return unmap()
+}
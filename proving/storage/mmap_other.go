@@ -0,0 +1,7 @@
+//go:build !unix
+
+package storage
+
+func mmapFile(string) (*Mapping, error) {
+	return nil, ErrMmapUnsupported
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+func mmapFile(filename string) (*Mapping, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	// The mapping stays valid once the file is closed.
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return &Mapping{}, nil
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	// Artifacts are read once front to back.
+	_ = syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+	return &Mapping{data: data, unmap: func() error {
+		return syscall.Munmap(data)
+	}}, nil
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DefaultLogInterval is how often LogProgress subscribers log a transfer.
+const DefaultLogInterval = 10 * time.Second
+
+// Progress is a snapshot of an object being read.
+type Progress struct {
+	Key     string
+	Current int64
+	// Total is the size of the object, 0 when unknown.
+	Total   int64
+	Elapsed time.Duration
+	// Done is set on the final snapshot, once the object is fully read or
+	// its reader is closed.
+	Done bool
+}
+
+// Percent returns the percentage read, or 0 if the total is unknown.
+func (p Progress) Percent() int64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return p.Current * 100 / p.Total
+}
+
+// Rate returns the average number of bytes read per second.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Current) / p.Elapsed.Seconds()
+}
+
+// ETA estimates the time left at the average rate, or returns 0 if it cannot
+// be estimated.
+func (p Progress) ETA() time.Duration {
+	rate := p.Rate()
+	if p.Total <= 0 || rate <= 0 || p.Current >= p.Total {
+		return 0
+	}
+	return time.Duration(float64(p.Total-p.Current) / rate * float64(time.Second))
+}
+
+// ProgressFunc receives progress snapshots.
+type ProgressFunc func(p Progress)
+
+type progressSubscriber struct {
+	fn       ProgressFunc
+	interval time.Duration
+	last     time.Time
+}
+
+// ProgressTracker measures the progress of a transfer and notifies its
+// subscribers as it advances. It is safe for concurrent use.
+type ProgressTracker struct {
+	// deliver serializes calls to the subscribers, so they receive snapshots
+	// in order and nothing after the final one. It is taken before lock.
+	deliver     sync.Mutex
+	lock        sync.Mutex
+	key         string
+	total       int64
+	start       time.Time
+	current     int64
+	done        bool
+	subscribers []*progressSubscriber
+}
+
+func NewProgressTracker(key string, total int64) *ProgressTracker {
+	return &ProgressTracker{key: key, total: total, start: time.Now()}
+}
+
+// Subscribe calls fn as the transfer advances, at most once per interval
+// except for the final snapshot, which is always delivered.
+func (t *ProgressTracker) Subscribe(interval time.Duration, fn ProgressFunc) *ProgressTracker {
+	t.lock.Lock()
+	t.subscribers = append(t.subscribers, &progressSubscriber{fn: fn, interval: interval})
+	t.lock.Unlock()
+	return t
+}
+
+// Add records n more bytes read.
+func (t *ProgressTracker) Add(n int64) {
+	t.update(n, false)
+}
+
+// Finish marks the transfer as over and delivers the final snapshot. Later
+// calls have no effect.
+func (t *ProgressTracker) Finish() {
+	t.update(0, true)
+}
+
+func (t *ProgressTracker) Snapshot() Progress {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.snapshot(time.Now())
+}
+
+func (t *ProgressTracker) snapshot(now time.Time) Progress {
+	return Progress{
+		Key:     t.key,
+		Current: t.current,
+		Total:   t.total,
+		Elapsed: now.Sub(t.start),
+		Done:    t.done,
+	}
+}
+
+func (t *ProgressTracker) update(n int64, done bool) {
+	t.deliver.Lock()
+	defer t.deliver.Unlock()
+	now := time.Now()
+	t.lock.Lock()
+	if t.done {
+		t.lock.Unlock()
+		return
+	}
+	t.current += n
+	t.done = done
+	p := t.snapshot(now)
+	var notify []ProgressFunc
+	for _, s := range t.subscribers {
+		if done || now.Sub(s.last) >= s.interval {
+			s.last = now
+			notify = append(notify, s.fn)
+		}
+	}
+	t.lock.Unlock()
+	// Subscribers are called without the lock, so they may snapshot, but
+	// must not update the tracker.
+	for _, fn := range notify {
+		fn(p)
+	}
+}
+
+// LogProgress returns a subscriber logging progress with message.
+func LogProgress(message string) ProgressFunc {
+	return func(p Progress) {
+		ctx := []interface{}{"key", p.Key, "current", p.Current, "total", p.Total, "rate", formatRate(p.Rate())}
+		if p.Done {
+			ctx = append(ctx, "elapsed", p.Elapsed.Round(time.Millisecond))
+		} else if p.Total > 0 {
+			ctx = append(ctx, "percent", p.Percent(), "eta", p.ETA().Round(time.Second))
+		}
+		log.Info(message, ctx...)
+	}
+}
+
+func formatRate(rate float64) string {
+	const mib = 1 << 20
+	return strconv.FormatFloat(rate/mib, 'f', 1, 64) + " MiB/s"
+}
+
+type progressReader struct {
+	io.Reader
+	io.Closer
+	tracker *ProgressTracker
+}
+
+// NewProgressReader reports the bytes read from r to tracker, finishing it
+// at EOF or on Close.
+func NewProgressReader(r io.ReadCloser, tracker *ProgressTracker) io.ReadCloser {
+	return &progressReader{
+		Reader:  r,
+		Closer:  r,
+		tracker: tracker,
+	}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	p.tracker.Add(int64(n))
+	if err == io.EOF {
+		p.tracker.Finish()
+	}
+	return n, err
+}
+
+func (p *progressReader) Size() int64 {
+	return p.tracker.total
+}
+
+func (p *progressReader) Close() error {
+	p.tracker.Finish()
+	return p.Closer.Close()
+}
+
+// ReaderSize returns the size of the object behind a reader returned from
+// Storage.Reader, or 0 if the size is unknown.
+func ReaderSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size()
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil {
+			return 0
+		}
+		return info.Size()
+	}
+	return 0
+}
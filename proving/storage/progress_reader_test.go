@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestProgressTrackerDeliversInOrder(t *testing.T) {
+	tracker := NewProgressTracker("a.pk", 0)
+	var delivered []Progress
+	tracker.Subscribe(0, func(p Progress) {
+		// Subscribers may snapshot the tracker they are called from.
+		_ = tracker.Snapshot()
+		delivered = append(delivered, p)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tracker.Add(1)
+			}
+			tracker.Finish()
+		}()
+	}
+	wg.Wait()
+
+	if len(delivered) == 0 {
+		t.Fatal("no snapshots delivered")
+	}
+	for i := 1; i < len(delivered); i++ {
+		if delivered[i].Current < delivered[i-1].Current {
+			t.Fatalf("snapshot %d went back from %d to %d", i, delivered[i-1].Current, delivered[i].Current)
+		}
+	}
+	for i, p := range delivered {
+		if p.Done != (i == len(delivered)-1) {
+			t.Fatalf("snapshot %d of %d has Done %t", i, len(delivered), p.Done)
+		}
+	}
+}
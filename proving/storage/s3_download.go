@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	DefaultS3PartSize    = 64 * 1024 * 1024
+	DefaultS3Concurrency = 8
+	DefaultS3MaxRetries  = 5
+)
+
+// S3DownloadConfig tunes the ranged downloads of S3Storage readers. Zero
+// values use the defaults.
+type S3DownloadConfig struct {
+	// PartSize is the size in bytes of each ranged GET.
+	PartSize int64
+	// Concurrency is the number of parts downloaded at once, which also bounds
+	// the number of parts buffered in memory.
+	Concurrency int
+	// MaxRetries is the number of times a failed part is resumed before the
+	// read fails; negative disables retries.
+	MaxRetries int
+}
+
+func (c S3DownloadConfig) withDefaults() S3DownloadConfig {
+	if c.PartSize <= 0 {
+		c.PartSize = DefaultS3PartSize
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultS3Concurrency
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	} else if c.MaxRetries == 0 {
+		c.MaxRetries = DefaultS3MaxRetries
+	}
+	return c
+}
+
+type partResult struct {
+	data []byte
+	err  error
+}
+
+// rangedReader reads an S3 object in order while its parts are downloaded
+// in parallel with ranged GETs. A part that fails is resumed from the last
+// byte received, and every request is pinned to the object's ETag so a
+// concurrent overwrite fails the read instead of mixing two objects.
+type rangedReader struct {
+	s      S3Storage
+	key    string
+	etag   *string
+	size   int64
+	cfg    S3DownloadConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+	parts  []chan partResult
+	// slots bounds the parts downloaded or buffered ahead of the reader.
+	slots chan struct{}
+	next  int
+	cur   *bytes.Reader
+	err   error
+}
+
+func newRangedReader(ctx context.Context, s S3Storage, key string, etag *string, size int64, cfg S3DownloadConfig) *rangedReader {
+	ctx, cancel := context.WithCancel(ctx)
+	n := int((size + cfg.PartSize - 1) / cfg.PartSize)
+	r := &rangedReader{
+		s:      s,
+		key:    key,
+		etag:   etag,
+		size:   size,
+		cfg:    cfg,
+		ctx:    ctx,
+		cancel: cancel,
+		parts:  make([]chan partResult, n),
+		slots:  make(chan struct{}, cfg.Concurrency),
+	}
+	for i := range r.parts {
+		r.parts[i] = make(chan partResult, 1)
+	}
+	go r.schedule()
+	return r
+}
+
+// schedule starts the part downloads in order, as slots free up.
+func (r *rangedReader) schedule() {
+	for i := range r.parts {
+		select {
+		case r.slots <- struct{}{}:
+		case <-r.ctx.Done():
+			return
+		}
+		start := int64(i) * r.cfg.PartSize
+		end := min(start+r.cfg.PartSize, r.size)
+		go func(i int) {
+			data, err := r.fetch(start, end)
+			r.parts[i] <- partResult{data: data, err: err}
+		}(i)
+	}
+}
+
+// fetch downloads the bytes [start, end) of the object, resuming after
+// failures.
+func (r *rangedReader) fetch(start, end int64) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, end-start))
+	for attempt := 0; ; attempt++ {
+		offset := start + int64(buf.Len())
+		object, err := r.s.client.GetObject(r.ctx, &s3.GetObjectInput{
+			Bucket:  &r.s.bucket,
+			Key:     &r.key,
+			Range:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, end-1)),
+			IfMatch: r.etag,
+		})
+		if err == nil {
+			_, err = io.CopyN(buf, object.Body, end-offset)
+			_ = object.Body.Close()
+		}
+		if err == nil {
+			return buf.Bytes(), nil
+		}
+		if attempt >= r.cfg.MaxRetries || r.ctx.Err() != nil {
+			return nil, fmt.Errorf("unable to download bytes %d-%d of %s: %w", start, end-1, r.key, notExist(err))
+		}
+		delay := time.Duration(1<<attempt) * 100 * time.Millisecond
+		log.Warn("Retrying S3 part download", "key", r.key, "offset", start+int64(buf.Len()), "attempt", attempt+1, "delay", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-r.ctx.Done():
+			return nil, r.ctx.Err()
+		}
+	}
+}
+
+func (r *rangedReader) Read(b []byte) (int, error) {
+	for r.cur == nil || r.cur.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.next == len(r.parts) {
+			return 0, io.EOF
+		}
+		var part partResult
+		select {
+		case part = <-r.parts[r.next]:
+		case <-r.ctx.Done():
+			r.err = r.ctx.Err()
+			continue
+		}
+		if part.err != nil {
+			r.err = part.err
+			r.cancel()
+			continue
+		}
+		r.cur = bytes.NewReader(part.data)
+		r.next++
+		// The part is now held by the reader, let the next one download.
+		<-r.slots
+	}
+	return r.cur.Read(b)
+}
+
+func (r *rangedReader) Size() int64 {
+	return r.size
+}
+
+func (r *rangedReader) Close() error {
+	r.cancel()
+	return nil
+}
@@ -2,10 +2,12 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -13,49 +15,66 @@ import (
 )
 
 type S3Storage struct {
-	client *s3.Client
-	bucket string
+	client   *s3.Client
+	bucket   string
+	download S3DownloadConfig
 }
 
-func NewS3Storage(bucket string) (Storage, error) {
+func NewS3Storage(bucket string, download S3DownloadConfig) (Storage, error) {
 	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"))
 	if err != nil {
 		return nil, fmt.Errorf("unable to load SDK config: %w", err)
 	}
 	return &S3Storage{
-		client: s3.NewFromConfig(cfg),
-		bucket: bucket,
+		client:   s3.NewFromConfig(cfg),
+		bucket:   bucket,
+		download: download.withDefaults(),
 	}, nil
 }
 
 func (s S3Storage) Reader(key string) (io.ReadCloser, error) {
-	attributes, err := s.client.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
-		Bucket:           &s.bucket,
-		Key:              &key,
-		ObjectAttributes: []types.ObjectAttributes{types.ObjectAttributesObjectSize},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("unable to get object attributes: %w", err)
-	}
+	return s.ReaderContext(context.Background(), key)
+}
+
+func (s S3Storage) Writer(key string) (io.WriteCloser, error) {
+	return s.WriterContext(context.Background(), key)
+}
+
+func (s S3Storage) Stat(key string) (ObjectInfo, error) {
+	return s.StatContext(context.Background(), key)
+}
 
-	object, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+func (s S3Storage) List(prefix string) ([]ObjectInfo, error) {
+	return s.ListContext(context.Background(), prefix)
+}
+
+func (s S3Storage) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+// ReaderContext downloads an object with parallel ranged GETs, see
+// S3DownloadConfig.
+func (s S3Storage) ReaderContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: &s.bucket,
 		Key:    &key,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to get object: %w", err)
+		return nil, fmt.Errorf("unable to get object metadata: %w", notExist(err))
 	}
-	return NewLoggingReader(object.Body, "Downloading", key, *attributes.ObjectSize), nil
+	size := aws.ToInt64(head.ContentLength)
+	tracker := NewProgressTracker(key, size).Subscribe(DefaultLogInterval, LogProgress("Downloading"))
+	return NewProgressReader(newRangedReader(ctx, s, key, head.ETag, size, s.download), tracker), nil
 }
 
-func (s S3Storage) Writer(key string) (io.WriteCloser, error) {
+func (s S3Storage) WriterContext(ctx context.Context, key string) (io.WriteCloser, error) {
 	uploader := manager.NewUploader(s.client)
 
 	reader, writer := io.Pipe()
-	w := &writeWaiter{WriteCloser: writer}
+	w := &writeWaiter{PipeWriter: writer}
 	w.wg.Add(1)
 	go func() {
-		_, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
+		_, err := uploader.Upload(ctx, &s3.PutObjectInput{
 			Bucket: &s.bucket,
 			Key:    &key,
 			Body:   reader,
@@ -69,16 +88,81 @@ func (s S3Storage) Writer(key string) (io.WriteCloser, error) {
 	return w, nil
 }
 
+func (s S3Storage) StatContext(ctx context.Context, key string) (ObjectInfo, error) {
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("unable to get object metadata: %w", notExist(err))
+	}
+	return ObjectInfo{
+		Key:     key,
+		Size:    aws.ToInt64(head.ContentLength),
+		ModTime: aws.ToTime(head.LastModified),
+	}, nil
+}
+
+func (s S3Storage) ListContext(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: &s.bucket,
+		Prefix: &prefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list objects: %w", err)
+		}
+		for _, o := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:     aws.ToString(o.Key),
+				Size:    aws.ToInt64(o.Size),
+				ModTime: aws.ToTime(o.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (s S3Storage) DeleteContext(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete object: %w", err)
+	}
+	return nil
+}
+
+// notExist maps the S3 errors for missing objects to ErrNotExist.
+func notExist(err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return fmt.Errorf("%w: %v", ErrNotExist, err)
+	}
+	return err
+}
+
 type writeWaiter struct {
-	io.WriteCloser
+	*io.PipeWriter
 	wg sync.WaitGroup
 }
 
 func (w *writeWaiter) Close() error {
-	err := w.WriteCloser.Close()
+	err := w.PipeWriter.Close()
 	if err != nil {
 		return err
 	}
 	w.wg.Wait()
 	return nil
 }
+
+// Abort fails the upload, so the object is never created.
+func (w *writeWaiter) Abort() error {
+	_ = w.PipeWriter.CloseWithError(errAborted)
+	w.wg.Wait()
+	return nil
+}
@@ -1,10 +1,74 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"io"
+	"io/fs"
+	"time"
 )
 
+// ErrNotExist is returned, possibly wrapped, when a key is not in the
+// storage. It is fs.ErrNotExist, so errors from the os package match it too.
+var ErrNotExist = fs.ErrNotExist
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage holds circuit artifacts and other objects by key. The methods
+// without a context use context.Background().
 type Storage interface {
 	Reader(key string) (io.ReadCloser, error)
 	Writer(key string) (io.WriteCloser, error)
+	// Stat returns the metadata of an object, or ErrNotExist.
+	Stat(key string) (ObjectInfo, error)
+	// List returns the objects whose key starts with prefix, sorted by key.
+	List(prefix string) ([]ObjectInfo, error)
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(key string) error
+
+	ReaderContext(ctx context.Context, key string) (io.ReadCloser, error)
+	WriterContext(ctx context.Context, key string) (io.WriteCloser, error)
+	StatContext(ctx context.Context, key string) (ObjectInfo, error)
+	ListContext(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	DeleteContext(ctx context.Context, key string) error
+}
+
+var errAborted = errors.New("write aborted")
+
+// Aborter is implemented by writers that only commit their object on Close.
+// Abort discards what was written instead, leaving any previous object in
+// place.
+type Aborter interface {
+	Abort() error
+}
+
+// Abort discards a partially written object. Writers that cannot discard
+// writes are closed instead.
+func Abort(w io.WriteCloser) error {
+	if a, ok := w.(Aborter); ok {
+		return a.Abort()
+	}
+	return w.Close()
+}
+
+// contextReader stops reading once its context is done.
+type contextReader struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (r *contextReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(b)
+}
+
+func (r *contextReader) Size() int64 {
+	return ReaderSize(r.ReadCloser)
 }
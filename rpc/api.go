@@ -1,40 +1,357 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math/big"
 
+	"github.com/base-org/keyspace-recovery-service/aggregation"
+	"github.com/base-org/keyspace-recovery-service/auth"
+	"github.com/base-org/keyspace-recovery-service/circuits"
 	"github.com/base-org/keyspace-recovery-service/proving"
 	"github.com/base-org/keyspace-recovery-service/signatures"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
+var ErrUnknownJob = errors.New("unknown job")
+
+var ErrUnsupportedSignatureType = errors.New("unsupported signature type")
+
+var ErrNotAggregatable = errors.New("proofs cannot be aggregated")
+
 type Recover struct {
-	loader proving.CircuitLoader
+	loader  proving.CircuitLoader
+	jobs    *JobQueue
+	auth    *auth.Authenticator
+	limiter *auth.Limiter
+	limits  RequestLimits
 }
 
-func NewRecover(loader proving.CircuitLoader) *Recover {
+// NewRecover creates the recover RPC service. The authenticator and limiter
+// may be nil, in which case all callers are anonymous and unlimited.
+func NewRecover(loader proving.CircuitLoader, jobs *JobQueue, authenticator *auth.Authenticator, limiter *auth.Limiter, limits RequestLimits) *Recover {
 	return &Recover{
-		loader: loader,
+		loader:  loader,
+		jobs:    jobs,
+		auth:    authenticator,
+		limiter: limiter,
+		limits:  limits,
+	}
+}
+
+// ProveOptions are the optional trailing parameter of the proving methods.
+type ProveOptions struct {
+	// CircuitVersion selects a circuit version by name, e.g. "v1".
+	CircuitVersion string `json:"circuitVersion,omitempty"`
+	// VkHash selects the circuit version whose verifying key the Keyspace key
+	// was created with.
+	VkHash *common.Hash `json:"vkHash,omitempty"`
+	// BatchSize is the number of transactions proven at once, selecting the
+	// compiled variant of MultiTx circuits. Defaults to 1.
+	BatchSize int `json:"batchSize,omitempty"`
+	// Aggregate also wraps the account proof into a BN254 proof that can be
+	// verified on Ethereum, returned in the response's aggregate field.
+	Aggregate bool `json:"aggregate,omitempty"`
+}
+
+func (o *ProveOptions) selection() circuits.Selection {
+	var sel circuits.Selection
+	if o == nil {
+		return sel
 	}
+	sel.Version = o.CircuitVersion
+	if o.VkHash != nil {
+		sel.VkHash = o.VkHash.Hex()
+	}
+	sel.TxCount = o.BatchSize
+	return sel
 }
 
-type ProveSignatureHandler func(key, newKey254 *big.Int, signature []byte, signatureType string, circuitLoader proving.CircuitLoader) (*signatures.ProveSignatureResponse, error)
+// ProveSignatureHandler proves a signature with a circuit. Before proving, it
+// solves the circuit with the assignment; with dryRun it stops there and
+// returns a response without a proof.
+type ProveSignatureHandler func(key, newKey254 *big.Int, signature []byte, signatureType string, sel circuits.Selection, dryRun bool, circuitLoader proving.CircuitLoader, reporter proving.Reporter) (*signatures.ProveSignatureResponse, error)
 
+// ProveSignatureHandlers maps signature types to their handler, see
+// signatures.AccountCircuits for the circuit proving each of them.
 var ProveSignatureHandlers = map[string]ProveSignatureHandler{
 	"secp256k1": signatures.ProveSignatureSecp256k1,
 	"webauthn":  signatures.ProveSignatureWebAuthn,
 }
 
-func (r *Recover) ProveSignature(key, newKey *hexutil.Big, signature hexutil.Bytes, signatureType string) (*signatures.ProveSignatureResponse, error) {
+func (r *Recover) ProveSignature(ctx context.Context, key, newKey *hexutil.Big, signature hexutil.Bytes, signatureType string, options *ProveOptions) (*signatures.ProveSignatureResponse, error) {
 	log.Info("Proving for recover_proveSignature call", "key", key, "newKey", newKey, "signatureType", signatureType)
-	newKey254 := new(big.Int).Rsh(newKey.ToInt(), 2)
+	job, err := r.submit(ctx, key, newKey, signature, signatureType, options)
+	if err != nil {
+		return nil, err
+	}
+	return job.Wait()
+}
 
+// SubmitProveSignature queues a proof and returns its job id immediately. Use
+// recover_jobStatus or a jobProgress subscription to follow it.
+func (r *Recover) SubmitProveSignature(ctx context.Context, key, newKey *hexutil.Big, signature hexutil.Bytes, signatureType string, options *ProveOptions) (string, error) {
+	log.Info("Queueing proof for recover_submitProveSignature call", "key", key, "newKey", newKey, "signatureType", signatureType)
+	job, err := r.submit(ctx, key, newKey, signature, signatureType, options)
+	if err != nil {
+		return "", err
+	}
+	return job.Id(), nil
+}
+
+// DryRun performs all the validation of recover_proveSignature and solves the
+// circuit with the request's assignment, without loading the proving key or
+// generating a proof. It runs immediately rather than through the job queue,
+// and returns the response a proof would have, without the proof itself.
+func (r *Recover) DryRun(ctx context.Context, key, newKey *hexutil.Big, signature hexutil.Bytes, signatureType string, options *ProveOptions) (*signatures.ProveSignatureResponse, error) {
+	log.Info("Solving for recover_dryRun call", "key", key, "newKey", newKey, "signatureType", signatureType)
+	if err := r.validate(key, newKey, signature, signatureType); err != nil {
+		return nil, err
+	}
+	release, err := r.acquire(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return ProveSignatureWith(r.loader, nil, key.ToInt(), newKey.ToInt(), signature, signatureType, options.selection(), true)
+}
+
+func (r *Recover) JobStatus(id string) (*JobStatus, error) {
+	job, ok := r.jobs.Get(id)
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+	status := job.Status()
+	return &status, nil
+}
+
+// JobProgress streams status changes for a job until it finishes, via
+// recover_subscribe("jobProgress", id).
+func (r *Recover) JobProgress(ctx context.Context, id string) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	job, ok := r.jobs.Get(id)
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+
+	sub := notifier.CreateSubscription()
+	updates, unsubscribe := job.Subscribe()
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case status := <-updates:
+				if err := notifier.Notify(sub.ID, status); err != nil {
+					log.Warn("Failed to send job progress", "id", id, "error", err)
+					return
+				}
+				if status.Finished() {
+					return
+				}
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+func (r *Recover) submit(ctx context.Context, key, newKey *hexutil.Big, signature hexutil.Bytes, signatureType string, options *ProveOptions) (*Job, error) {
+	if err := r.validate(key, newKey, signature, signatureType); err != nil {
+		return nil, err
+	}
+	if options != nil && options.Aggregate {
+		if err := aggregatable(signatureType, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	release, err := r.acquire(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	prove := r.prove(key, newKey, signature, signatureType, options)
+	return r.jobs.Submit(func(reporter proving.Reporter) (*signatures.ProveSignatureResponse, error) {
+		defer release()
+		return prove(reporter)
+	}), nil
+}
+
+// validate checks a proving request before it is queued.
+func (r *Recover) validate(key, newKey *hexutil.Big, signature hexutil.Bytes, signatureType string) error {
+	if err := r.limits.check(key, newKey, signature); err != nil {
+		return err
+	}
+	if _, ok := ProveSignatureHandlers[signatureType]; !ok {
+		return ErrUnsupportedSignatureType
+	}
+	return nil
+}
+
+// aggregatable checks that proofs of signatureType can be aggregated in
+// batches of txCount, which needs the aggregation circuits to be deployed and
+// only works for BLS12-377 account proofs; BN254 account proofs are verified
+// on Ethereum as they are.
+func aggregatable(signatureType string, txCount int) error {
+	cm, err := circuits.ById(signatures.AccountCircuits[signatureType])
+	if err != nil {
+		return err
+	}
+	if cm.Curve() != ecc.BLS12_377 {
+		return fmt.Errorf("%w: %s proofs are on %s, only bls12_377 proofs can be aggregated", ErrNotAggregatable, signatureType, cm.Curve())
+	}
+	return aggregation.Deployed(txCount)
+}
+
+// prove returns the job proving a validated request, aggregating the proof if
+// the options ask for it.
+func (r *Recover) prove(key, newKey *hexutil.Big, signature hexutil.Bytes, signatureType string, options *ProveOptions) JobFunc {
+	return func(reporter proving.Reporter) (*signatures.ProveSignatureResponse, error) {
+		response, err := ProveSignatureWith(r.loader, reporter, key.ToInt(), newKey.ToInt(), signature, signatureType, options.selection(), false)
+		if err != nil || options == nil || !options.Aggregate {
+			return response, err
+		}
+		response.Aggregate, err = aggregation.Prove(r.loader, reporter, []aggregation.Account{{
+			Proof:       response.Proof,
+			Vk:          response.CurrentVk,
+			CurrentData: response.CurrentData,
+			NewKey:      newKey254(newKey.ToInt()),
+		}})
+		if err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+// AccountProof is an account proof to aggregate: the fields of a
+// recover_proveSignature response and the new key it was proven for.
+type AccountProof struct {
+	Proof       hexutil.Bytes `json:"proof"`
+	CurrentVk   hexutil.Bytes `json:"currentVk"`
+	CurrentData hexutil.Bytes `json:"currentData"`
+	NewKey      *hexutil.Big  `json:"newKey"`
+	// SignatureType is the type the proof was requested with, selecting the
+	// account circuit it is verified as; secp256k1 if empty.
+	SignatureType string `json:"signatureType,omitempty"`
+}
+
+// VerifyProof checks an account proof, as returned by recover_proveSignature,
+// against its verifying key and public inputs without proving anything. It
+// returns an error describing why an invalid proof was rejected.
+func (r *Recover) VerifyProof(proof AccountProof) (bool, error) {
+	if proof.NewKey == nil {
+		return false, errors.New("missing newKey")
+	}
+	signatureType := proof.SignatureType
+	if signatureType == "" {
+		signatureType = "secp256k1"
+	}
+	id, ok := signatures.AccountCircuits[signatureType]
+	if !ok {
+		return false, ErrUnsupportedSignatureType
+	}
+	cm, err := circuits.ById(id)
+	if err != nil {
+		return false, err
+	}
+	if err = signatures.VerifyAccountProof(cm, proof.Proof, proof.CurrentVk, proof.CurrentData, newKey254(proof.NewKey.ToInt())); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AggregateProofs wraps one or many account proofs into a single BN254 proof
+// that can be verified on Ethereum. It is bounded like a batch and charged to
+// the caller's limits as one proof and job per account, as the cost of the
+// aggregate circuit grows with the number of accounts.
+func (r *Recover) AggregateProofs(ctx context.Context, proofs []AccountProof) (*signatures.AggregateProofResponse, error) {
+	log.Info("Aggregating proofs for recover_aggregateProofs call", "count", len(proofs))
+	if len(proofs) == 0 {
+		return nil, aggregation.ErrNoAccounts
+	}
+	if r.limits.MaxBatchRequests > 0 && len(proofs) > r.limits.MaxBatchRequests {
+		return nil, fmt.Errorf("aggregation exceeds %d proofs", r.limits.MaxBatchRequests)
+	}
+	if err := aggregation.Deployed(len(proofs)); err != nil {
+		return nil, err
+	}
+	accounts := make([]aggregation.Account, len(proofs))
+	for i, p := range proofs {
+		if p.NewKey == nil {
+			return nil, fmt.Errorf("proof %d: missing newKey", i)
+		}
+		accounts[i] = aggregation.Account{
+			Proof:       p.Proof,
+			Vk:          p.CurrentVk,
+			CurrentData: p.CurrentData,
+			NewKey:      newKey254(p.NewKey.ToInt()),
+		}
+	}
+
+	release, err := r.acquire(ctx, len(proofs))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return r.aggregate(accounts)
+}
+
+// aggregate runs the aggregation of account proofs as a job and waits for it.
+func (r *Recover) aggregate(accounts []aggregation.Account) (*signatures.AggregateProofResponse, error) {
+	job := r.jobs.Submit(func(reporter proving.Reporter) (*signatures.ProveSignatureResponse, error) {
+		aggregate, err := aggregation.Prove(r.loader, reporter, accounts)
+		if err != nil {
+			return nil, err
+		}
+		return &signatures.ProveSignatureResponse{Aggregate: aggregate}, nil
+	})
+	response, err := job.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return response.Aggregate, nil
+}
+
+// ProveSignatureWith proves a signature synchronously with the given loader,
+// bypassing the job queue. The reporter may be nil. With dryRun the request is
+// only validated and solved, and the response has no proof.
+func ProveSignatureWith(loader proving.CircuitLoader, reporter proving.Reporter, key, newKey *big.Int, signature []byte, signatureType string, sel circuits.Selection, dryRun bool) (*signatures.ProveSignatureResponse, error) {
 	handler, ok := ProveSignatureHandlers[signatureType]
 	if !ok {
-		return nil, errors.New("unsupported signature type")
+		return nil, ErrUnsupportedSignatureType
 	}
 
-	return handler(key.ToInt(), newKey254, signature, signatureType, r.loader)
+	return handler(key, newKey254(newKey), signature, signatureType, sel, dryRun, loader, reporter)
+}
+
+// newKey254 is the NewKey public input of the account circuits for a
+// Keyspace key.
+func newKey254(newKey *big.Int) *big.Int {
+	return new(big.Int).Rsh(newKey, 2)
+}
+
+// acquire charges n proofs to the caller's rate limits and job quotas.
+func (r *Recover) acquire(ctx context.Context, n int) (func(), error) {
+	if r.limiter == nil {
+		return func() {}, nil
+	}
+	var id auth.Identity
+	if r.auth != nil {
+		id = r.auth.Identity(ctx)
+	}
+	release, err := r.limiter.AcquireN(id, n)
+	if err != nil {
+		log.Warn("Rejected proving request", "subject", id.Subject, "ip", id.IP, "error", err)
+		return nil, err
+	}
+	return release, nil
 }
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/base-org/keyspace-recovery-service/aggregation"
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/signatures"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var ErrEmptyBatch = errors.New("empty batch")
+
+// ProveSignatureRequest is one item of a recover_proveSignatureBatch call,
+// with the parameters of recover_proveSignature.
+type ProveSignatureRequest struct {
+	Key           *hexutil.Big  `json:"key"`
+	NewKey        *hexutil.Big  `json:"newKey"`
+	Signature     hexutil.Bytes `json:"signature"`
+	SignatureType string        `json:"signatureType"`
+	Options       *ProveOptions `json:"options,omitempty"`
+}
+
+// BatchOptions are the optional trailing parameter of
+// recover_proveSignatureBatch.
+type BatchOptions struct {
+	// Aggregate wraps the proofs of the batch into a single BN254 proof that
+	// can be verified on Ethereum. It is only attempted if every item
+	// succeeded.
+	Aggregate bool `json:"aggregate,omitempty"`
+}
+
+// ProveSignatureBatchResult is the outcome of one item of a batch: its
+// response or the reason it failed.
+type ProveSignatureBatchResult struct {
+	JobId  string                             `json:"jobId,omitempty"`
+	Result *signatures.ProveSignatureResponse `json:"result,omitempty"`
+	Error  string                             `json:"error,omitempty"`
+}
+
+type ProveSignatureBatchResponse struct {
+	// Results are in the order of the requests.
+	Results        []ProveSignatureBatchResult        `json:"results"`
+	Aggregate      *signatures.AggregateProofResponse `json:"aggregate,omitempty"`
+	AggregateError string                             `json:"aggregateError,omitempty"`
+}
+
+// batchGroup identifies the circuit a request is proven with, so requests
+// sharing a proving key run back to back.
+type batchGroup struct {
+	signatureType string
+	sel           circuits.Selection
+}
+
+// ProveSignatureBatch proves many signatures in one call. Valid requests are
+// queued grouped by circuit, so each proving key is loaded once and reused
+// while it is hot; invalid or failing requests only fail their own item. The
+// batch is charged to the caller's limits as one proof and job per request.
+func (r *Recover) ProveSignatureBatch(ctx context.Context, requests []ProveSignatureRequest, options *BatchOptions) (*ProveSignatureBatchResponse, error) {
+	log.Info("Proving for recover_proveSignatureBatch call", "count", len(requests))
+	if len(requests) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if r.limits.MaxBatchRequests > 0 && len(requests) > r.limits.MaxBatchRequests {
+		return nil, fmt.Errorf("batch exceeds %d requests", r.limits.MaxBatchRequests)
+	}
+	if options != nil && options.Aggregate {
+		if err := aggregation.Deployed(len(requests)); err != nil {
+			return nil, err
+		}
+	}
+
+	response := &ProveSignatureBatchResponse{Results: make([]ProveSignatureBatchResult, len(requests))}
+	groups := make(map[batchGroup]int)
+	var queued []int
+	for i, req := range requests {
+		err := r.validate(req.Key, req.NewKey, req.Signature, req.SignatureType)
+		if err == nil && req.Options != nil && req.Options.Aggregate {
+			err = aggregatable(req.SignatureType, 1)
+		}
+		if err != nil {
+			response.Results[i].Error = err.Error()
+			continue
+		}
+		g := batchGroup{req.SignatureType, req.Options.selection()}
+		if _, ok := groups[g]; !ok {
+			groups[g] = len(groups)
+		}
+		queued = append(queued, i)
+	}
+	sort.SliceStable(queued, func(a, b int) bool {
+		ra, rb := requests[queued[a]], requests[queued[b]]
+		return groups[batchGroup{ra.SignatureType, ra.Options.selection()}] < groups[batchGroup{rb.SignatureType, rb.Options.selection()}]
+	})
+
+	if len(queued) > 0 {
+		release, err := r.acquire(ctx, len(queued))
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		runs := make([]JobFunc, len(queued))
+		for j, i := range queued {
+			req := requests[i]
+			runs[j] = r.prove(req.Key, req.NewKey, req.Signature, req.SignatureType, req.Options)
+		}
+		jobs := r.jobs.SubmitAll(runs)
+		for j, i := range queued {
+			result := &response.Results[i]
+			result.JobId = jobs[j].Id()
+			if result.Result, err = jobs[j].Wait(); err != nil {
+				result.Error = err.Error()
+			}
+		}
+	}
+
+	if options != nil && options.Aggregate {
+		response.Aggregate, response.AggregateError = r.aggregateBatch(requests, response.Results)
+	}
+	return response, nil
+}
+
+// aggregateBatch aggregates the proofs of a batch in which every item
+// succeeded, returning the reason aggregation failed otherwise.
+func (r *Recover) aggregateBatch(requests []ProveSignatureRequest, results []ProveSignatureBatchResult) (*signatures.AggregateProofResponse, string) {
+	accounts := make([]aggregation.Account, len(results))
+	for i, result := range results {
+		if result.Result == nil {
+			return nil, fmt.Sprintf("request %d failed, not aggregating", i)
+		}
+		if err := aggregatable(requests[i].SignatureType, len(results)); err != nil {
+			return nil, fmt.Sprintf("request %d: %v", i, err)
+		}
+		accounts[i] = aggregation.Account{
+			Proof:       result.Result.Proof,
+			Vk:          result.Result.CurrentVk,
+			CurrentData: result.Result.CurrentData,
+			NewKey:      newKey254(requests[i].NewKey.ToInt()),
+		}
+	}
+	aggregate, err := r.aggregate(accounts)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return aggregate, ""
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/base-org/keyspace-recovery-service/proving/storage"
+	"github.com/base-org/keyspace-recovery-service/signatures"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type JobStatus struct {
+	Id       string        `json:"id"`
+	Stage    proving.Stage `json:"stage"`
+	Position int           `json:"position,omitempty"`
+	Key      string        `json:"key,omitempty"`
+	Percent  int64         `json:"percent,omitempty"`
+	// Rate is the average loading rate in bytes per second, and Eta the
+	// estimated seconds left loading Key.
+	Rate   int64                              `json:"rate,omitempty"`
+	Eta    int64                              `json:"eta,omitempty"`
+	Result *signatures.ProveSignatureResponse `json:"result,omitempty"`
+	Error  string                             `json:"error,omitempty"`
+}
+
+func (s JobStatus) Finished() bool {
+	return s.Stage == proving.StageDone || s.Stage == proving.StageFailed
+}
+
+type JobFunc func(reporter proving.Reporter) (*signatures.ProveSignatureResponse, error)
+
+// Job is a single queued proving request. It implements proving.Reporter so
+// that the loader and prover can push state changes to subscribers.
+type Job struct {
+	run         JobFunc
+	lock        sync.Mutex
+	status      JobStatus
+	err         error
+	finished    time.Time
+	done        chan struct{}
+	subscribers map[chan JobStatus]struct{}
+}
+
+var _ proving.Reporter = (*Job)(nil)
+
+func (j *Job) Id() string {
+	return j.status.Id
+}
+
+func (j *Job) Status() JobStatus {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.status
+}
+
+// Wait blocks until the job has finished and returns its result.
+func (j *Job) Wait() (*signatures.ProveSignatureResponse, error) {
+	<-j.done
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.status.Result, j.err
+}
+
+// Subscribe returns a channel receiving the current status followed by every
+// subsequent change. Slow readers only see the latest status, but the final
+// status is always delivered. The returned function must be called to release
+// the subscription.
+func (j *Job) Subscribe() (<-chan JobStatus, func()) {
+	ch := make(chan JobStatus, 1)
+	j.lock.Lock()
+	j.subscribers[ch] = struct{}{}
+	ch <- j.status
+	j.lock.Unlock()
+	return ch, func() {
+		j.lock.Lock()
+		delete(j.subscribers, ch)
+		j.lock.Unlock()
+	}
+}
+
+func (j *Job) ReportStage(stage proving.Stage) {
+	j.update(func(s *JobStatus) bool {
+		if s.Stage == stage {
+			return false
+		}
+		s.Stage = stage
+		s.Position = 0
+		s.Key = ""
+		s.Percent = 0
+		s.Rate = 0
+		s.Eta = 0
+		return true
+	})
+}
+
+func (j *Job) ReportLoading(p storage.Progress) {
+	if p.Total <= 0 {
+		return
+	}
+	percent := p.Percent()
+	j.update(func(s *JobStatus) bool {
+		if s.Stage != proving.StageLoading || (s.Key == p.Key && s.Percent == percent) {
+			return false
+		}
+		s.Key = p.Key
+		s.Percent = percent
+		s.Rate = int64(p.Rate())
+		s.Eta = int64(p.ETA().Seconds())
+		return true
+	})
+}
+
+func (j *Job) setPosition(position int) {
+	j.update(func(s *JobStatus) bool {
+		if s.Position == position {
+			return false
+		}
+		s.Position = position
+		return true
+	})
+}
+
+func (j *Job) finish(result *signatures.ProveSignatureResponse, err error) {
+	j.update(func(s *JobStatus) bool {
+		s.Position = 0
+		s.Key = ""
+		s.Percent = 0
+		if err != nil {
+			s.Stage = proving.StageFailed
+			s.Error = err.Error()
+		} else {
+			s.Stage = proving.StageDone
+			s.Result = result
+		}
+		return true
+	})
+	j.lock.Lock()
+	j.err = err
+	j.finished = time.Now()
+	j.lock.Unlock()
+	close(j.done)
+}
+
+// update applies fn to the job status and, if it reports a change, publishes
+// the new status to all subscribers.
+func (j *Job) update(fn func(s *JobStatus) bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.status.Finished() || !fn(&j.status) {
+		return
+	}
+	for ch := range j.subscribers {
+		select {
+		case ch <- j.status:
+		default:
+			// Replace the pending status with the latest one.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- j.status
+		}
+	}
+}
+
+// JobQueue runs proving jobs in FIFO order with a fixed number of workers,
+// keeping finished jobs around for a retention period so their results can be
+// fetched.
+type JobQueue struct {
+	lock      sync.Mutex
+	cond      *sync.Cond
+	queue     []*Job
+	jobs      map[string]*Job
+	retention time.Duration
+}
+
+// NewJobQueue starts a queue running concurrency jobs at a time, or one per
+// CPU if concurrency is not positive.
+func NewJobQueue(concurrency int, retention time.Duration) *JobQueue {
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU()
+	}
+	q := &JobQueue{
+		jobs:      make(map[string]*Job),
+		retention: retention,
+	}
+	q.cond = sync.NewCond(&q.lock)
+	for i := 0; i < concurrency; i++ {
+		go q.work()
+	}
+	return q
+}
+
+func (q *JobQueue) Submit(run JobFunc) *Job {
+	return q.SubmitAll([]JobFunc{run})[0]
+}
+
+// SubmitAll queues several jobs back to back, so they are started in order
+// without jobs from other requests in between.
+func (q *JobQueue) SubmitAll(runs []JobFunc) []*Job {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.prune()
+	jobs := make([]*Job, len(runs))
+	for i, run := range runs {
+		job := &Job{
+			run:         run,
+			done:        make(chan struct{}),
+			subscribers: make(map[chan JobStatus]struct{}),
+		}
+		job.status = JobStatus{
+			Id:       string(rpc.NewID()),
+			Stage:    proving.StageQueued,
+			Position: len(q.queue) + 1,
+		}
+		q.jobs[job.Id()] = job
+		q.queue = append(q.queue, job)
+		q.cond.Signal()
+		log.Info("Job queued", "id", job.Id(), "position", job.status.Position)
+		jobs[i] = job
+	}
+	return jobs
+}
+
+func (q *JobQueue) Get(id string) (*Job, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	job, ok := q.jobs[id]
+	return job, ok
+}
+
+func (q *JobQueue) work() {
+	for {
+		q.lock.Lock()
+		for len(q.queue) == 0 {
+			q.cond.Wait()
+		}
+		job := q.queue[0]
+		q.queue = q.queue[1:]
+		for i, queued := range q.queue {
+			queued.setPosition(i + 1)
+		}
+		q.lock.Unlock()
+
+		log.Info("Job started", "id", job.Id())
+		result, err := q.run(job)
+		log.Info("Job finished", "id", job.Id(), "error", err)
+		job.finish(result, err)
+	}
+}
+
+func (q *JobQueue) run(job *Job) (result *signatures.ProveSignatureResponse, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v, stack: %s", r, string(debug.Stack()))
+		}
+	}()
+	return job.run(job)
+}
+
+// prune drops finished jobs older than the retention period. Must be called
+// with q.lock held.
+func (q *JobQueue) prune() {
+	for id, job := range q.jobs {
+		job.lock.Lock()
+		expired := !job.finished.IsZero() && time.Since(job.finished) > q.retention
+		job.lock.Unlock()
+		if expired {
+			delete(q.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// maxKeyBits is the size of a Keyspace key.
+const maxKeyBits = 256
+
+// RequestLimits bounds the size of request parameters, checked before any
+// decoding is done by a ProveSignatureHandler.
+type RequestLimits struct {
+	MaxSignatureSize int
+	// MaxBatchRequests bounds the number of requests of a
+	// recover_proveSignatureBatch call; 0 disables the limit.
+	MaxBatchRequests int
+}
+
+func (l RequestLimits) check(key, newKey *hexutil.Big, signature hexutil.Bytes) error {
+	if key == nil || newKey == nil {
+		return fmt.Errorf("missing key")
+	}
+	if key.ToInt().Sign() < 0 || key.ToInt().BitLen() > maxKeyBits {
+		return fmt.Errorf("key exceeds %d bits", maxKeyBits)
+	}
+	if newKey.ToInt().Sign() < 0 || newKey.ToInt().BitLen() > maxKeyBits {
+		return fmt.Errorf("newKey exceeds %d bits", maxKeyBits)
+	}
+	if l.MaxSignatureSize > 0 && len(signature) > l.MaxSignatureSize {
+		return fmt.Errorf("signature exceeds %d bytes", l.MaxSignatureSize)
+	}
+	return nil
+}
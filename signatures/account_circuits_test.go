@@ -0,0 +1,150 @@
+package signatures
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	gecdsa "github.com/consensys/gnark/std/signature/ecdsa"
+	"github.com/consensys/gnark/test"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// testNewKey returns a random new key, a BN254 Keyspace key shifted right by
+// 2 bits.
+func testNewKey(t *testing.T) *big.Int {
+	t.Helper()
+	k, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 252))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// assertSolved checks that the circuit of cm accepts valid and rejects
+// invalid.
+func assertSolved(t *testing.T, cm *circuits.Metadata, valid, invalid frontend.Circuit) {
+	t.Helper()
+	circuit, err := cm.Definition(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = test.IsSolved(circuit, valid, cm.Field); err != nil {
+		t.Fatalf("%s: valid witness rejected: %v", cm.Id, err)
+	}
+	if err = test.IsSolved(circuit, invalid, cm.Field); err == nil {
+		t.Fatalf("%s: invalid witness accepted", cm.Id)
+	}
+}
+
+func secp256k1Assignment(t *testing.T, newKey *big.Int) *circuits.EcdsaAccount[emulated.Secp256k1Fp, emulated.Secp256k1Fr] {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := crypto.Sign(newKey.FillBytes(make([]byte, 32)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, currentData, err := publicKeyToCircuitData(key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, err := splitSignature(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &circuits.EcdsaAccount[emulated.Secp256k1Fp, emulated.Secp256k1Fr]{
+		CurrentData: currentData,
+		NewKey:      newKey,
+		Sig: gecdsa.Signature[emulated.Secp256k1Fr]{
+			R: emulated.ValueOf[emulated.Secp256k1Fr](r),
+			S: emulated.ValueOf[emulated.Secp256k1Fr](s),
+		},
+	}
+}
+
+func TestSecp256k1AccountCircuit(t *testing.T) {
+	newKey := testNewKey(t)
+	valid := secp256k1Assignment(t, newKey)
+	// The same signature does not authorize another key.
+	invalid := *valid
+	invalid.NewKey = new(big.Int).Add(newKey, big.NewInt(1))
+	for _, cm := range []*circuits.Metadata{circuits.Secp256k1AccountMetadata, circuits.Secp256k1AccountBn254Metadata} {
+		assertSolved(t, cm, valid, &invalid)
+	}
+}
+
+func webauthnAssignment(t *testing.T, newKey *big.Int) *circuits.WebauthnAccount {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticatorData := make([]byte, AuthenticatorDataSize)
+	authenticatorData[32] = 0x05
+	challenge := base64.RawURLEncoding.EncodeToString(common.BytesToHash(newKey.Bytes()).Bytes())
+	suffix := []byte(`","origin":"https://keys.coinbase.com","crossOrigin":false}`)
+	clientDataJSON := append([]byte(ClientDataJSONPrefix+challenge), suffix...)
+	clientHash := sha256.Sum256(clientDataJSON)
+	hash := sha256.Sum256(append(authenticatorData, clientHash[:]...))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, currentData, err := publicKeyToCircuitData(key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded, blockCount, err := PaddedClientDataSuffix(suffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authData, err := AuthenticatorData(authenticatorData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &circuits.WebauthnAccount{
+		CurrentData: currentData,
+		NewKey:      newKey,
+		Sig: gecdsa.Signature[emulated.P256Fr]{
+			R: emulated.ValueOf[emulated.P256Fr](r),
+			S: emulated.ValueOf[emulated.P256Fr](s),
+		},
+		ClientDataSuffixBlockCount: blockCount,
+		PaddedClientDataSuffix:     padded,
+		AuthenticatorData:          authData,
+	}
+}
+
+func TestWebauthnAccountCircuit(t *testing.T) {
+	newKey := testNewKey(t)
+	valid := webauthnAssignment(t, newKey)
+	// The challenge must be the new key, and the signed data must not change.
+	for name, invalid := range map[string]func(a *circuits.WebauthnAccount){
+		"new key": func(a *circuits.WebauthnAccount) {
+			a.NewKey = new(big.Int).Add(newKey, big.NewInt(1))
+		},
+		"authenticator data": func(a *circuits.WebauthnAccount) {
+			a.AuthenticatorData[32] = a.AuthenticatorData[0]
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := *valid
+			invalid(&a)
+			for _, cm := range []*circuits.Metadata{circuits.WebauthnAccountMetadata, circuits.WebauthnAccountBn254Metadata} {
+				assertSolved(t, cm, valid, &a)
+			}
+		})
+	}
+}
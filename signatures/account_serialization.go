@@ -14,6 +14,8 @@ import (
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
 	rplonk "github.com/consensys/gnark/std/recursion/plonk"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 const RawDataSize = 256
@@ -112,6 +114,11 @@ func BytesToVk(b []byte) (*pbls12377.VerifyingKey, error) {
 	return vk, nil
 }
 
+// VkHash returns the keccak256 hash of a verification key serialized with VkToBytes.
+func VkHash(vkBytes []byte) common.Hash {
+	return crypto.Keccak256Hash(vkBytes)
+}
+
 // CircuitVkToVariables converts a BLS12-377 circuit plonk.VerifyingKey to a slice of frontend.Variable.
 // Used in-circuit to serialize the verification key ready for Poseidon hashing it in BW6-761.
 func CircuitVkToVariables(api frontend.API, field *emulated.Field[sw_bls12377.ScalarField], vk rplonk.VerifyingKey[sw_bls12377.ScalarField, sw_bls12377.G1Affine, sw_bls12377.G2Affine]) ([]frontend.Variable, error) {
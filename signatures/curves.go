@@ -0,0 +1,230 @@
+package signatures
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	bn254fr "github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/plonk"
+	pbls12377 "github.com/consensys/gnark/backend/plonk/bls12-377"
+	pbn254 "github.com/consensys/gnark/backend/plonk/bn254"
+	pbw6761 "github.com/consensys/gnark/backend/plonk/bw6-761"
+)
+
+// AccountCircuits maps each signature type to the id of the account circuit
+// proving it. The BN254 account circuits, whose proofs are verified on
+// Ethereum directly, get "-bn254" types once they are deployed.
+var AccountCircuits = map[string]string{
+	"secp256k1": circuits.Secp256k1AccountMetadata.Id,
+	"webauthn":  circuits.WebauthnAccountMetadata.Id,
+}
+
+// accountCircuit returns the account circuit proving signatureType.
+func accountCircuit(signatureType string) (*circuits.Metadata, error) {
+	id, ok := AccountCircuits[signatureType]
+	if !ok {
+		return nil, fmt.Errorf("no account circuit for signature type %q", signatureType)
+	}
+	return circuits.ById(id)
+}
+
+// curveSerializer encodes the proofs and verifying keys of one curve for
+// responses, and decodes them back for verification.
+type curveSerializer struct {
+	proof     func(plonk.Proof) ([]byte, error)
+	vk        func(plonk.VerifyingKey) ([]byte, error)
+	readProof func([]byte) (plonk.Proof, error)
+	readVk    func([]byte) (plonk.VerifyingKey, error)
+}
+
+var serializers = map[ecc.ID]curveSerializer{
+	// BLS12-377 proofs use the onchain encoding of ProofToBytes and VkToBytes.
+	ecc.BLS12_377: {
+		proof: func(p plonk.Proof) ([]byte, error) {
+			proof, ok := p.(*pbls12377.Proof)
+			if !ok {
+				return nil, ErrInvalidProof
+			}
+			return ProofToBytes(proof)
+		},
+		vk: func(v plonk.VerifyingKey) ([]byte, error) {
+			vk, ok := v.(*pbls12377.VerifyingKey)
+			if !ok {
+				return nil, ErrInvalidVk
+			}
+			return VkToBytes(vk)
+		},
+		readProof: func(b []byte) (plonk.Proof, error) {
+			return BytesToProof(b)
+		},
+		readVk: func(b []byte) (plonk.VerifyingKey, error) {
+			return BytesToVk(b)
+		},
+	},
+	// BN254 proofs are the calldata of the circuit's Solidity verifier.
+	ecc.BN254: {
+		proof: func(p plonk.Proof) ([]byte, error) {
+			proof, ok := p.(*pbn254.Proof)
+			if !ok {
+				return nil, ErrInvalidProof
+			}
+			return proof.MarshalSolidity(), nil
+		},
+		vk: binaryVk,
+		readProof: func(b []byte) (plonk.Proof, error) {
+			return bn254SolidityProof(b)
+		},
+		readVk: func(b []byte) (plonk.VerifyingKey, error) {
+			return readBytes(b, new(pbn254.VerifyingKey))
+		},
+	},
+	ecc.BW6_761: {
+		proof: func(p plonk.Proof) ([]byte, error) {
+			return writeBytes(p)
+		},
+		vk: binaryVk,
+		readProof: func(b []byte) (plonk.Proof, error) {
+			return readBytes(b, new(pbw6761.Proof))
+		},
+		readVk: func(b []byte) (plonk.VerifyingKey, error) {
+			return readBytes(b, new(pbw6761.VerifyingKey))
+		},
+	},
+}
+
+// binaryVk encodes a verifying key with gnark, so its keccak256 hash is the
+// name of the compiled circuit, as for circuits without an onchain layout.
+func binaryVk(vk plonk.VerifyingKey) ([]byte, error) {
+	return writeBytes(vk)
+}
+
+func writeBytes(w io.WriterTo) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readBytes decodes the gnark binary encoding of an object, which must span
+// all of b.
+func readBytes[T io.ReaderFrom](b []byte, v T) (T, error) {
+	n, err := v.ReadFrom(bytes.NewReader(b))
+	if err == nil && n != int64(len(b)) {
+		err = fmt.Errorf("%d trailing bytes", int64(len(b))-n)
+	}
+	return v, err
+}
+
+// bn254SolidityProof decodes a BN254 proof from the calldata of its Solidity
+// verifier, the inverse of MarshalSolidity.
+func bn254SolidityProof(b []byte) (*pbn254.Proof, error) {
+	// Fixed part: 9 points and 8 scalars; then per commitment a scalar and a
+	// point.
+	const points, scalars = 9, 8
+	fixed := points*bn254.SizeOfG1AffineUncompressed + scalars*bn254fr.Bytes
+	perCommitment := bn254fr.Bytes + bn254.SizeOfG1AffineUncompressed
+	if len(b) < fixed || (len(b)-fixed)%perCommitment != 0 {
+		return nil, ErrInvalidProof
+	}
+	commitments := (len(b) - fixed) / perCommitment
+	var err error
+	point := func(p *bn254.G1Affine) {
+		if err == nil {
+			_, err = p.SetBytes(b[:bn254.SizeOfG1AffineUncompressed])
+		}
+		b = b[bn254.SizeOfG1AffineUncompressed:]
+	}
+	scalar := func(e *bn254fr.Element) {
+		e.SetBytes(b[:bn254fr.Bytes])
+		b = b[bn254fr.Bytes:]
+	}
+
+	proof := new(pbn254.Proof)
+	proof.BatchedProof.ClaimedValues = make([]bn254fr.Element, 7+commitments)
+	proof.Bsb22Commitments = make([]bn254.G1Affine, commitments)
+	for i := range proof.LRO {
+		point(&proof.LRO[i])
+	}
+	for i := range proof.H {
+		point(&proof.H[i])
+	}
+	// l, r, o, s1 and s2 at zeta.
+	for i := 2; i < 7; i++ {
+		scalar(&proof.BatchedProof.ClaimedValues[i])
+	}
+	point(&proof.Z)
+	scalar(&proof.ZShiftedOpening.ClaimedValue)
+	// The quotient and linearization polynomials at zeta.
+	scalar(&proof.BatchedProof.ClaimedValues[0])
+	scalar(&proof.BatchedProof.ClaimedValues[1])
+	point(&proof.BatchedProof.H)
+	point(&proof.ZShiftedOpening.H)
+	for i := range proof.Bsb22Commitments {
+		scalar(&proof.BatchedProof.ClaimedValues[7+i])
+	}
+	for i := range proof.Bsb22Commitments {
+		point(&proof.Bsb22Commitments[i])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	return proof, nil
+}
+
+func serializer(cm *circuits.Metadata) (curveSerializer, error) {
+	s, ok := serializers[cm.Curve()]
+	if !ok {
+		return curveSerializer{}, fmt.Errorf("circuit %s: unsupported curve %s", cm.Id, cm.Curve())
+	}
+	return s, nil
+}
+
+// ProofBytes serializes a proof of circuit cm for a response.
+func ProofBytes(cm *circuits.Metadata, proof plonk.Proof) ([]byte, error) {
+	s, err := serializer(cm)
+	if err != nil {
+		return nil, err
+	}
+	return s.proof(proof)
+}
+
+// ReadProof decodes a proof of circuit cm serialized with ProofBytes.
+func ReadProof(cm *circuits.Metadata, b []byte) (plonk.Proof, error) {
+	s, err := serializer(cm)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := s.readProof(b)
+	if err != nil && !errors.Is(err, ErrInvalidProof) {
+		err = fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	return proof, err
+}
+
+// ReadVk decodes a verifying key of circuit cm serialized with VkBytes.
+func ReadVk(cm *circuits.Metadata, b []byte) (plonk.VerifyingKey, error) {
+	s, err := serializer(cm)
+	if err != nil {
+		return nil, err
+	}
+	vk, err := s.readVk(b)
+	if err != nil && !errors.Is(err, ErrInvalidVk) {
+		err = fmt.Errorf("%w: %v", ErrInvalidVk, err)
+	}
+	return vk, err
+}
+
+// VkBytes serializes a verifying key of circuit cm for a response.
+func VkBytes(cm *circuits.Metadata, vk plonk.VerifyingKey) ([]byte, error) {
+	s, err := serializer(cm)
+	if err != nil {
+		return nil, err
+	}
+	return s.vk(vk)
+}
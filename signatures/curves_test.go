@@ -0,0 +1,83 @@
+package signatures
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+)
+
+// committedCircuit proves knowledge of a square root, committing to it so
+// proofs carry a BSB22 commitment.
+type committedCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *committedCircuit) Define(api frontend.API) error {
+	commitment, err := api.Compiler().(frontend.Committer).Commit(c.X)
+	if err != nil {
+		return err
+	}
+	api.AssertIsDifferent(commitment, 0)
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	return nil
+}
+
+func TestSerializationRoundTrip(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BW6_761} {
+		t.Run(curve.String(), func(t *testing.T) {
+			cm := &circuits.Metadata{Id: "Test", Field: curve.ScalarField(), Outer: curve.ScalarField()}
+			ccs, err := proving.Compile(&committedCircuit{}, cm.Field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cc, err := proving.Setup(ccs, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proof, err := proving.ProveAssignment(*cm, cc, &committedCircuit{X: 3, Y: 9}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proofBytes, err := ProofBytes(cm, proof)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vkBytes, err := VkBytes(cm, cc.Vk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := ReadProof(cm, proofBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vk, err := ReadVk(cm, vkBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			public, err := frontend.NewWitness(&committedCircuit{Y: 9}, cm.Field, frontend.PublicOnly())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = plonk.Verify(decoded, vk, public); err != nil {
+				t.Fatal(err)
+			}
+			if reencoded, err := ProofBytes(cm, decoded); err != nil || !bytes.Equal(reencoded, proofBytes) {
+				t.Fatalf("proof changed in a round trip: %v", err)
+			}
+
+			if _, err = ReadProof(cm, proofBytes[:len(proofBytes)-1]); err == nil {
+				t.Fatal("truncated proof accepted")
+			}
+			if _, err = ReadVk(cm, append(vkBytes, 0)); err == nil {
+				t.Fatal("vk with trailing bytes accepted")
+			}
+		})
+	}
+}
@@ -7,13 +7,12 @@ import (
 
 	"github.com/base-org/keyspace-recovery-service/circuits"
 	"github.com/base-org/keyspace-recovery-service/proving"
-	bls12377 "github.com/consensys/gnark/backend/plonk/bls12-377"
 	"github.com/consensys/gnark/std/math/emulated"
 	gecdsa "github.com/consensys/gnark/std/signature/ecdsa"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
-func ProveSignatureSecp256k1(key, newKey254 *big.Int, signature []byte, signatureType string, circuitLoader proving.CircuitLoader) (*ProveSignatureResponse, error) {
+func ProveSignatureSecp256k1(key, newKey254 *big.Int, signature []byte, signatureType string, sel circuits.Selection, dryRun bool, circuitLoader proving.CircuitLoader, reporter proving.Reporter) (*ProveSignatureResponse, error) {
 	if len(signature) != 65 {
 		return nil, errors.New("invalid signature length")
 	}
@@ -38,41 +37,66 @@ func ProveSignatureSecp256k1(key, newKey254 *big.Int, signature []byte, signatur
 		return nil, err
 	}
 
-	clc := proving.NewCircuitLoaderClient(circuitLoader)
-	cc, err := clc.Load(circuits.Secp256k1AccountMetadata, 0)
+	cm, err := accountCircuit(signatureType)
 	if err != nil {
 		return nil, err
 	}
-
-	proof, err := proving.ProveAssignment(*circuits.Secp256k1AccountMetadata, cc, &circuits.EcdsaAccount[emulated.Secp256k1Fp, emulated.Secp256k1Fr]{
+	version, err := cm.Select(sel)
+	if err != nil {
+		return nil, err
+	}
+	assignment := &circuits.EcdsaAccount[emulated.Secp256k1Fp, emulated.Secp256k1Fr]{
 		CurrentData: currentDataInput,
 		NewKey:      newKey254,
 		Sig: gecdsa.Signature[emulated.Secp256k1Fr]{
 			R: emulated.ValueOf[emulated.Secp256k1Fr](signatureR),
 			S: emulated.ValueOf[emulated.Secp256k1Fr](signatureS),
 		},
-	})
+	}
+
+	// Check the assignment before the proving key is loaded, so invalid
+	// requests fail fast with the unsatisfied constraint.
+	clc := proving.NewCircuitLoaderClient(circuitLoader, reporter)
+	cc, err := clc.Solve(cm, version, sel.TxCount, assignment)
 	if err != nil {
 		return nil, err
 	}
+	vkBytes, err := VkBytes(cm, cc.Vk)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return &ProveSignatureResponse{
+			CurrentVk:      vkBytes,
+			CurrentData:    currentData,
+			CircuitVersion: version.Name,
+			Deprecated:     version.Deprecated,
+		}, nil
+	}
 
-	bls12377AccountProof, ok := proof.(*bls12377.Proof)
-	if !ok {
-		return nil, errors.New("invalid proof")
+	cc, err = clc.Load(cm, version, sel.TxCount)
+	if err != nil {
+		return nil, err
 	}
-	proofBytes, err := ProofToBytes(bls12377AccountProof)
+	proof, err := proving.ProveAssignment(*cm, cc, assignment, reporter)
 	if err != nil {
 		return nil, err
 	}
-	vkBytes, err := getVkBytes(cc.Vk)
+
+	proofBytes, err := ProofBytes(cm, proof)
 	if err != nil {
 		return nil, err
 	}
+	if err = verifySerialized(cm, proofBytes, vkBytes, currentData, newKey254, reporter); err != nil {
+		return nil, err
+	}
 
 	return &ProveSignatureResponse{
-		Proof:       proofBytes,
-		CurrentVk:   vkBytes,
-		CurrentData: currentData,
+		Proof:          proofBytes,
+		CurrentVk:      vkBytes,
+		CurrentData:    currentData,
+		CircuitVersion: version.Name,
+		Deprecated:     version.Deprecated,
 	}, nil
 }
 
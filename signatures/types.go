@@ -6,4 +6,23 @@ type ProveSignatureResponse struct {
 	Proof       hexutil.Bytes `json:"proof"`
 	CurrentVk   hexutil.Bytes `json:"currentVk"`
 	CurrentData hexutil.Bytes `json:"currentData"`
+	// CircuitVersion is the circuit version the proof was generated with.
+	CircuitVersion string `json:"circuitVersion"`
+	// Deprecated is set when that version is deprecated; clients should
+	// migrate the key to a newer circuit.
+	Deprecated bool `json:"deprecated,omitempty"`
+	// Aggregate is set when an aggregate proof was requested.
+	Aggregate *AggregateProofResponse `json:"aggregate,omitempty"`
+}
+
+// AggregateProofResponse is a BN254 proof that a batch of account proofs is
+// valid, in the encoding expected by the Solidity verifier of the wrapper
+// circuit.
+type AggregateProofResponse struct {
+	Proof hexutil.Bytes `json:"proof"`
+	// Commitment is the proof's only public input: keccak256 over the vk hash,
+	// current data and new key of each account, truncated to 253 bits.
+	Commitment *hexutil.Big `json:"commitment"`
+	// CircuitVersion is the version of the wrapper circuit.
+	CircuitVersion string `json:"circuitVersion"`
 }
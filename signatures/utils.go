@@ -2,10 +2,12 @@ package signatures
 
 import (
 	"crypto/ecdsa"
-	"errors"
+	"fmt"
+	"math/big"
 
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving"
 	"github.com/consensys/gnark/backend/plonk"
-	bls12377 "github.com/consensys/gnark/backend/plonk/bls12-377"
 	"github.com/consensys/gnark/frontend"
 )
 
@@ -18,10 +20,53 @@ func publicKeyToCircuitData(publicKey ecdsa.PublicKey) (currentData []byte, curr
 	return
 }
 
-func getVkBytes(vk plonk.VerifyingKey) ([]byte, error) {
-	bls12377vk, ok := vk.(*bls12377.VerifyingKey)
-	if !ok {
-		return nil, errors.New("invalid vk")
+// verifySerialized checks an account proof after a round trip of the proof,
+// vk and public inputs through their serialization, if the circuit's
+// verification policy asks for it, so serialization bugs are caught before the
+// response is sent.
+func verifySerialized(cm *circuits.Metadata, proofBytes, vkBytes, currentData []byte, newKey254 *big.Int, reporter proving.Reporter) error {
+	if cm.VerificationPolicy() != circuits.VerifySerialized {
+		return nil
 	}
-	return VkToBytes(bls12377vk)
+	if reporter != nil {
+		reporter.ReportStage(proving.StageVerifying)
+	}
+	if err := VerifyAccountProof(cm, proofBytes, vkBytes, currentData, newKey254); err != nil {
+		return fmt.Errorf("%s: serialized proof: %w", cm.Id, err)
+	}
+	return nil
+}
+
+// VerifySerialized checks a proof of any circuit after a round trip of the
+// proof and vk through ProofBytes and VkBytes, if the circuit's verification
+// policy asks for it. The public inputs are taken from the assignment.
+func VerifySerialized(cm *circuits.Metadata, proof plonk.Proof, vk plonk.VerifyingKey, assignment frontend.Circuit, reporter proving.Reporter) error {
+	if cm.VerificationPolicy() != circuits.VerifySerialized {
+		return nil
+	}
+	proofBytes, err := ProofBytes(cm, proof)
+	if err != nil {
+		return err
+	}
+	vkBytes, err := VkBytes(cm, vk)
+	if err != nil {
+		return err
+	}
+	if proof, err = ReadProof(cm, proofBytes); err != nil {
+		return fmt.Errorf("%s: serialized proof: %w", cm.Id, err)
+	}
+	if vk, err = ReadVk(cm, vkBytes); err != nil {
+		return fmt.Errorf("%s: serialized proof: %w", cm.Id, err)
+	}
+	public, err := frontend.NewWitness(assignment, cm.Field, frontend.PublicOnly())
+	if err != nil {
+		return err
+	}
+	if reporter != nil {
+		reporter.ReportStage(proving.StageVerifying)
+	}
+	if err = proving.Verify(proof, vk, public, cm.Field, cm.Outer); err != nil {
+		return fmt.Errorf("%s: serialized proof: %w: %v", cm.Id, ErrInvalidProof, err)
+	}
+	return nil
 }
@@ -0,0 +1,56 @@
+package signatures
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/base-org/keyspace-recovery-service/circuits"
+	"github.com/base-org/keyspace-recovery-service/proving"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+// AccountPublicWitness returns the public witness of an account proof over
+// the scalar field field and its values: the current data in 31-byte chunks
+// followed by the NewKey input.
+func AccountPublicWitness(field *big.Int, currentData []byte, newKey254 *big.Int) (witness.Witness, []*big.Int, error) {
+	_, inputs, _, _, err := DataToBytes31Chunks(currentData)
+	if err != nil {
+		return nil, nil, err
+	}
+	inputs = append(inputs, newKey254)
+
+	public, err := witness.New(field)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make(chan any, len(inputs))
+	for _, v := range inputs {
+		values <- v
+	}
+	close(values)
+	if err = public.Fill(len(inputs), 0, values); err != nil {
+		return nil, nil, err
+	}
+	return public, inputs, nil
+}
+
+// VerifyAccountProof verifies a proof of account circuit cm given in the
+// serialization returned by the proving handlers, see ProofBytes and VkBytes.
+func VerifyAccountProof(cm *circuits.Metadata, proofBytes, vkBytes, currentData []byte, newKey254 *big.Int) error {
+	proof, err := ReadProof(cm, proofBytes)
+	if err != nil {
+		return err
+	}
+	vk, err := ReadVk(cm, vkBytes)
+	if err != nil {
+		return err
+	}
+	public, _, err := AccountPublicWitness(cm.Field, currentData, newKey254)
+	if err != nil {
+		return err
+	}
+	if err = proving.Verify(proof, vk, public, cm.Field, cm.Outer); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	return nil
+}
@@ -7,12 +7,12 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"math/big"
 	"strings"
 
 	"github.com/base-org/keyspace-recovery-service/circuits"
 	"github.com/base-org/keyspace-recovery-service/proving"
-	bls12377 "github.com/consensys/gnark/backend/plonk/bls12-377"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
 	gecdsa "github.com/consensys/gnark/std/signature/ecdsa"
@@ -20,11 +20,11 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 )
 
-const ClientDataJSONPrefix = `{"type":"webauthn.get","challenge":"`
+const ClientDataJSONPrefix = circuits.ClientDataJSONPrefix
 
 const webAuthnAuthAbiJSON = `{ "components": [ { "name": "authenticatorData", "type": "bytes" }, { "name": "clientDataJSON", "type": "bytes" }, { "name": "challengeIndex", "type": "uint256" }, { "name": "typeIndex", "type": "uint256" }, { "name": "r", "type": "uint256" }, { "name": "s", "type": "uint256" } ], "name": "WebAuthnAuth", "type": "tuple"}`
 
-func ProveSignatureWebAuthn(key, newKey254 *big.Int, signature []byte, signatureType string, circuitLoader proving.CircuitLoader) (*ProveSignatureResponse, error) {
+func ProveSignatureWebAuthn(key, newKey254 *big.Int, signature []byte, signatureType string, sel circuits.Selection, dryRun bool, circuitLoader proving.CircuitLoader, reporter proving.Reporter) (*ProveSignatureResponse, error) {
 	// Decode signature data into public key and bytes containing WebAuthnAuth.
 	var sigDataAbi [3]abi.Argument
 	sigDataAbi[0].UnmarshalJSON([]byte(`{"type":"bytes32"}`))
@@ -55,6 +55,9 @@ func ProveSignatureWebAuthn(key, newKey254 *big.Int, signature []byte, signature
 		R                 *big.Int "json:\"r\""
 		S                 *big.Int "json:\"s\""
 	})
+	if err = checkWebAuthnAuth(webAuthnAuth.AuthenticatorData, webAuthnAuth.ClientDataJSON); err != nil {
+		return nil, err
+	}
 	clientHash := sha256.Sum256(webAuthnAuth.ClientDataJSON)
 	hash := sha256.Sum256(append(webAuthnAuth.AuthenticatorData, clientHash[:]...))
 
@@ -78,14 +81,23 @@ func ProveSignatureWebAuthn(key, newKey254 *big.Int, signature []byte, signature
 		return nil, errors.New("invalid client data JSON")
 	}
 	clientDataJSONSuffix := webAuthnAuth.ClientDataJSON[len(ClientDataJSONPrefix+encoded):]
-	paddedSuffix, blockCount := PaddedClientDataSuffix(clientDataJSONSuffix)
-	clc := proving.NewCircuitLoaderClient(circuitLoader)
-	cc, err := clc.Load(circuits.WebauthnAccountMetadata, 0)
+	paddedSuffix, blockCount, err := PaddedClientDataSuffix(clientDataJSONSuffix)
 	if err != nil {
 		return nil, err
 	}
-
-	proof, err := proving.ProveAssignment(*circuits.WebauthnAccountMetadata, cc, &circuits.WebauthnAccount{
+	authenticatorData, err := AuthenticatorData(webAuthnAuth.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	cm, err := accountCircuit(signatureType)
+	if err != nil {
+		return nil, err
+	}
+	version, err := cm.Select(sel)
+	if err != nil {
+		return nil, err
+	}
+	assignment := &circuits.WebauthnAccount{
 		CurrentData: currentDataInput,
 		NewKey:      newKey254,
 		Sig: gecdsa.Signature[emulated.P256Fr]{
@@ -94,56 +106,111 @@ func ProveSignatureWebAuthn(key, newKey254 *big.Int, signature []byte, signature
 		},
 		ClientDataSuffixBlockCount: blockCount,
 		PaddedClientDataSuffix:     paddedSuffix,
-		AuthenticatorData:          AuthenticatorData(webAuthnAuth.AuthenticatorData),
-	})
+		AuthenticatorData:          authenticatorData,
+	}
+
+	// Check the assignment before the proving key is loaded, so invalid
+	// requests fail fast with the unsatisfied constraint.
+	clc := proving.NewCircuitLoaderClient(circuitLoader, reporter)
+	cc, err := clc.Solve(cm, version, sel.TxCount, assignment)
 	if err != nil {
 		return nil, err
 	}
+	vkBytes, err := VkBytes(cm, cc.Vk)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return &ProveSignatureResponse{
+			CurrentVk:      vkBytes,
+			CurrentData:    currentData,
+			CircuitVersion: version.Name,
+			Deprecated:     version.Deprecated,
+		}, nil
+	}
 
-	bls12377AccountProof, ok := proof.(*bls12377.Proof)
-	if !ok {
-		return nil, errors.New("invalid proof")
+	cc, err = clc.Load(cm, version, sel.TxCount)
+	if err != nil {
+		return nil, err
 	}
-	proofBytes, err := ProofToBytes(bls12377AccountProof)
+	proof, err := proving.ProveAssignment(*cm, cc, assignment, reporter)
 	if err != nil {
 		return nil, err
 	}
-	vkBytes, err := getVkBytes(cc.Vk)
+
+	proofBytes, err := ProofBytes(cm, proof)
 	if err != nil {
 		return nil, err
 	}
+	if err = verifySerialized(cm, proofBytes, vkBytes, currentData, newKey254, reporter); err != nil {
+		return nil, err
+	}
 
 	return &ProveSignatureResponse{
-		Proof:       proofBytes,
-		CurrentVk:   vkBytes,
-		CurrentData: currentData,
+		Proof:          proofBytes,
+		CurrentVk:      vkBytes,
+		CurrentData:    currentData,
+		CircuitVersion: version.Name,
+		Deprecated:     version.Deprecated,
 	}, nil
 }
 
-func PaddedClientDataSuffix(buf []byte) (res [241]uints.U8, count byte) {
-	bytesLen := len(buf)
-	zeroPadLen := 241 - bytesLen
-	lenPosition := zeroPadLen
-	count = 5 // 1x 64-bit block for prefix + challenge, and 4x 64-bit blocks for suffix + padding
-	for lenPosition > 64 {
-		lenPosition -= 64
-		count--
+const (
+	// AuthenticatorDataSize is the size of the authenticatorData the circuit
+	// signs over: the RP ID hash, flags and signature counter, without
+	// extensions.
+	AuthenticatorDataSize = len(circuits.WebauthnAccount{}.AuthenticatorData)
+	// MaxClientDataSuffixSize is the largest clientDataJSON suffix, after the
+	// challenge, whose SHA-256 padding fits the blocks hashed by the circuit.
+	MaxClientDataSuffixSize = clientDataSize - len(ClientDataJSONPrefix) - challengeSize - 9
+	// challengeSize is the length of the base64url encoded challenge.
+	challengeSize = 43
+	// clientDataSize is the size of the padded clientDataJSON hashed by the
+	// circuit.
+	clientDataSize = len(ClientDataJSONPrefix) + challengeSize + len(circuits.WebauthnAccount{}.PaddedClientDataSuffix)
+)
+
+// checkWebAuthnAuth bounds the fields of a WebAuthnAuth to what the circuit
+// accepts, before they are hashed or assigned.
+func checkWebAuthnAuth(authenticatorData, clientDataJSON []byte) error {
+	if len(authenticatorData) != AuthenticatorDataSize {
+		return fmt.Errorf("authenticatorData is %d bytes, expected %d", len(authenticatorData), AuthenticatorDataSize)
+	}
+	if max := len(ClientDataJSONPrefix) + challengeSize + MaxClientDataSuffixSize; len(clientDataJSON) > max {
+		return fmt.Errorf("clientDataJSON exceeds %d bytes", max)
+	}
+	return nil
+}
+
+// PaddedClientDataSuffix pads the clientDataJSON suffix following the
+// challenge as the end of a SHA-256 message, returning it with the number of
+// blocks of the padded clientDataJSON.
+func PaddedClientDataSuffix(buf []byte) (res [241]uints.U8, count byte, err error) {
+	if len(buf) > MaxClientDataSuffixSize {
+		return res, 0, fmt.Errorf("clientDataJSON suffix exceeds %d bytes", MaxClientDataSuffixSize)
 	}
-	for i, b := range buf {
+	prefixLen := len(ClientDataJSONPrefix) + challengeSize
+	messageLen := prefixLen + len(buf)
+	// The message is followed by 0x80 and its length in bits as a uint64,
+	// zero-padded to a whole number of blocks.
+	paddedLen := (messageLen + 9 + 63) / 64 * 64
+	padded := make([]byte, len(res))
+	copy(padded, buf)
+	padded[len(buf)] = 0x80
+	binary.BigEndian.PutUint64(padded[paddedLen-prefixLen-8:], uint64(8*messageLen))
+	for i, b := range padded {
 		res[i] = uints.NewU8(b)
 	}
-	padding := make([]byte, zeroPadLen)
-	padding[0] = 0x80
-	binary.BigEndian.PutUint64(padding[lenPosition-8:], uint64(8*(36+43+bytesLen)))
-	for i, b := range padding {
-		res[i+bytesLen] = uints.NewU8(b)
-	}
-	return
+	return res, byte(paddedLen / 64), nil
 }
 
-func AuthenticatorData(buf []byte) (res [37]uints.U8) {
+// AuthenticatorData converts the authenticatorData to the circuit's input.
+func AuthenticatorData(buf []byte) (res [37]uints.U8, err error) {
+	if len(buf) != len(res) {
+		return res, fmt.Errorf("authenticatorData is %d bytes, expected %d", len(buf), len(res))
+	}
 	for i, b := range buf {
 		res[i] = uints.NewU8(b)
 	}
-	return
+	return res, nil
 }
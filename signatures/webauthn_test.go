@@ -0,0 +1,61 @@
+package signatures
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// sha256Padding appends the SHA-256 padding to a message.
+func sha256Padding(message []byte) []byte {
+	padded := append(bytes.Clone(message), 0x80)
+	for len(padded)%64 != 56 {
+		padded = append(padded, 0)
+	}
+	return binary.BigEndian.AppendUint64(padded, uint64(8*len(message)))
+}
+
+func TestPaddedClientDataSuffix(t *testing.T) {
+	prefix := ClientDataJSONPrefix + strings.Repeat("A", challengeSize)
+	for n := 0; n <= MaxClientDataSuffixSize; n++ {
+		suffix := bytes.Repeat([]byte{'x'}, n)
+		res, count, err := PaddedClientDataSuffix(suffix)
+		if err != nil {
+			t.Fatalf("suffix of %d bytes: %v", n, err)
+		}
+		expected := sha256Padding(append([]byte(prefix), suffix...))
+		if int(count) != len(expected)/64 {
+			t.Fatalf("suffix of %d bytes: got %d blocks, expected %d", n, count, len(expected)/64)
+		}
+		got := []byte(prefix)
+		for _, b := range res {
+			got = append(got, b.Val.(uint8))
+		}
+		if !bytes.Equal(got[:len(expected)], expected) {
+			t.Fatalf("suffix of %d bytes: wrong padding", n)
+		}
+		if rest := got[len(expected):]; !bytes.Equal(rest, make([]byte, len(rest))) {
+			t.Fatalf("suffix of %d bytes: nonzero bytes after the padding", n)
+		}
+	}
+	if _, _, err := PaddedClientDataSuffix(make([]byte, MaxClientDataSuffixSize+1)); err == nil {
+		t.Fatal("oversized suffix accepted")
+	}
+}
+
+func TestCheckWebAuthnAuth(t *testing.T) {
+	clientData := []byte(ClientDataJSONPrefix + strings.Repeat("A", challengeSize) + `"}`)
+	if err := checkWebAuthnAuth(make([]byte, AuthenticatorDataSize), clientData); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, AuthenticatorDataSize - 1, AuthenticatorDataSize + 1} {
+		if err := checkWebAuthnAuth(make([]byte, n), clientData); err == nil {
+			t.Errorf("authenticatorData of %d bytes accepted", n)
+		}
+	}
+	oversized := append(clientData, make([]byte, MaxClientDataSuffixSize)...)
+	if err := checkWebAuthnAuth(make([]byte, AuthenticatorDataSize), oversized); err == nil {
+		t.Error("oversized clientDataJSON accepted")
+	}
+}